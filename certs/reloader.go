@@ -0,0 +1,89 @@
+// Package certs serves the TLS certificate of the server. It reloads the certificate when its files change or on
+// request, so a renewed certificate is picked up without a restart, and creates a self-signed one if there is none.
+package certs
+
+import (
+	"context"
+	"crypto/tls"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+// Reloader holds the certificate loaded from a cert and key file, see GetCertificate.
+type Reloader struct {
+	certFile, keyFile string
+
+	mu       sync.RWMutex
+	cert     *tls.Certificate
+	modified [2]time.Time
+}
+
+// NewReloader loads the certificate and fails if the files cannot be read or do not match.
+func NewReloader(certFile, keyFile string) (*Reloader, error) {
+	r := &Reloader{certFile: certFile, keyFile: keyFile}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Reload reads the files again. On failure the previous certificate stays in use.
+func (r *Reloader) Reload() error {
+	modified := r.modTimes()
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cert = &cert
+	r.modified = modified
+	if cert.Leaf != nil {
+		slog.Info("TLS certificate loaded", "file", r.certFile, "subject", cert.Leaf.Subject.String(), "notAfter", cert.Leaf.NotAfter)
+	}
+	return nil
+}
+
+// GetCertificate is used as tls.Config.GetCertificate.
+func (r *Reloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert, nil
+}
+
+// Watch reloads the certificate whenever a file was modified, checking every interval, and whenever reload
+// receives, e.g. on SIGHUP. It returns when ctx is cancelled.
+func (r *Reloader) Watch(ctx context.Context, interval time.Duration, reload <-chan os.Signal) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-reload:
+		case <-ticker.C:
+			r.mu.RLock()
+			unchanged := r.modTimes() == r.modified
+			r.mu.RUnlock()
+			if unchanged {
+				continue
+			}
+		}
+		// The files may be replaced one after the other, a failed reload is retried with the next tick
+		if err := r.Reload(); err != nil {
+			slog.ErrorContext(ctx, "Failed to reload TLS certificate, keeping the current one", "error", err)
+		}
+	}
+}
+
+func (r *Reloader) modTimes() [2]time.Time {
+	var modified [2]time.Time
+	for i, name := range []string{r.certFile, r.keyFile} {
+		if info, err := os.Stat(name); err == nil {
+			modified[i] = info.ModTime()
+		}
+	}
+	return modified
+}
@@ -0,0 +1,85 @@
+package certs
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io/fs"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestEnsureSelfSigned(t *testing.T) {
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "tls", "cert.pem")
+	keyFile := filepath.Join(dir, "tls", "key.pem")
+
+	created, err := EnsureSelfSigned(certFile, keyFile, []string{"home.example", "192.0.2.1"})
+	if err != nil || !created {
+		t.Fatalf("EnsureSelfSigned() = %v, %v, want a new certificate", created, err)
+	}
+	pair, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cert.IsCA || cert.KeyUsage != x509.KeyUsageDigitalSignature {
+		t.Errorf("certificate IsCA = %v, KeyUsage = %v, want a leaf for digital signatures", cert.IsCA, cert.KeyUsage)
+	}
+	if !slices.Equal(cert.ExtKeyUsage, []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}) {
+		t.Errorf("certificate ExtKeyUsage = %v, want server authentication", cert.ExtKeyUsage)
+	}
+	if err := cert.VerifyHostname("home.example"); err != nil {
+		t.Error(err)
+	}
+	if !slices.ContainsFunc(cert.IPAddresses, net.ParseIP("192.0.2.1").Equal) {
+		t.Errorf("certificate IPs = %v, want 192.0.2.1", cert.IPAddresses)
+	}
+	if info, err := os.Stat(keyFile); err != nil {
+		t.Error(err)
+	} else if info.Mode().Perm() != 0o600 {
+		t.Errorf("key file mode = %v, want 0600", info.Mode().Perm())
+	}
+
+	// A client that trusts the certificate accepts it for the server
+	roots := x509.NewCertPool()
+	roots.AddCert(cert)
+	if _, err := cert.Verify(x509.VerifyOptions{DNSName: "home.example", Roots: roots}); err != nil {
+		t.Errorf("Verify() error = %v", err)
+	}
+
+	created, err = EnsureSelfSigned(certFile, keyFile, nil)
+	if err != nil || created {
+		t.Errorf("EnsureSelfSigned() with existing files = %v, %v, want to keep them", created, err)
+	}
+	if err := os.Remove(certFile); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := EnsureSelfSigned(certFile, keyFile, nil); err == nil {
+		t.Error("EnsureSelfSigned() with only the key file succeeded")
+	}
+}
+
+func TestEnsureSelfSignedKeyNotWritable(t *testing.T) {
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "cert.pem")
+	// The key directory cannot be created because a file has its name
+	blocker := filepath.Join(dir, "keys")
+	if err := os.WriteFile(blocker, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	keyFile := filepath.Join(blocker, "key.pem")
+
+	if _, err := EnsureSelfSigned(certFile, keyFile, nil); err == nil {
+		t.Fatal("EnsureSelfSigned() succeeded without writing the key")
+	}
+	if _, err := os.Stat(certFile); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("certificate file is left behind, stat error = %v", err)
+	}
+}
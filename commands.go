@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"homeApplications/config"
+	"homeApplications/migrate"
+	"homeApplications/sql/migrations"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const usage = `Usage: homeApplications [command] [flags]
+
+Commands:
+  (none)             start the server
+  migrate            apply pending database migrations
+  migrate status     list the migrations and their state
+  migrate validate   check that the database matches the migrations
+  config print       show the effective configuration, secrets redacted
+
+Flags:
+  -config file       TOML file with the configuration, default $CONFIG_FILE
+  -<section>.<key>   any setting of the configuration, e.g. -server.addr=:8081, see config print`
+
+// runCommand runs the command given before the flags and returns the exit code.
+func runCommand(ctx context.Context, cfg config.Config, args []string) int {
+	if len(args) == 2 && args[0] == "config" && args[1] == "print" {
+		if err := config.Print(os.Stdout, cfg); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		return 0
+	}
+	if args[0] != "migrate" || len(args) > 2 {
+		fmt.Fprintln(os.Stderr, usage)
+		return 2
+	}
+	pool, err := pgxpool.New(ctx, cfg.Database.URL)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Unable to connect to database:", err)
+		return 1
+	}
+	defer pool.Close()
+
+	command := "up"
+	if len(args) == 2 {
+		command = args[1]
+	}
+	switch command {
+	case "up":
+		err = migrate.Up(ctx, pool, migrations.FS)
+	case "status":
+		err = printMigrationStatus(ctx, pool)
+	case "validate":
+		if err = migrate.Validate(ctx, pool, migrations.FS); err == nil {
+			fmt.Println("Database schema matches the migrations")
+		}
+	default:
+		fmt.Fprintln(os.Stderr, usage)
+		return 2
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+func printMigrationStatus(ctx context.Context, pool *pgxpool.Pool) error {
+	statuses, err := migrate.Info(ctx, pool, migrations.FS)
+	if err != nil {
+		return err
+	}
+	table := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "VERSION\tDESCRIPTION\tSTATE\tINSTALLED ON")
+	for _, status := range statuses {
+		installedOn := ""
+		if status.InstalledOn != nil {
+			installedOn = status.InstalledOn.Format(time.DateTime)
+		}
+		fmt.Fprintf(table, "%s\t%s\t%s\t%s\n", status.Version, status.Description, status.State, installedOn)
+	}
+	return table.Flush()
+}
@@ -0,0 +1,218 @@
+// Package config holds the settings of the server. They are read from a TOML file, environment variables and
+// command line flags, in that order, each source overriding the previous one.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"slices"
+	"strings"
+	"time"
+
+	"homeApplications/middleware"
+	"homeApplications/models"
+	"homeApplications/music"
+)
+
+// Every field has a key in the file, e.g. server.addr, which is also the name of its flag (-server.addr).
+// The env tag keeps the environment variables the server was configured with before the config file existed.
+// Durations are given like "15m" or as whole seconds.
+type Config struct {
+	Server    Server    `toml:"server"`
+	TLS       TLS       `toml:"tls"`
+	Database  Database  `toml:"database"`
+	Log       Log       `toml:"log"`
+	Auth      Auth      `toml:"auth"`
+	Music     Music     `toml:"music"`
+	Scheduler Scheduler `toml:"scheduler"`
+	Health    Health    `toml:"health"`
+	Metrics   Metrics   `toml:"metrics"`
+}
+
+type Server struct {
+	Addr        string   `toml:"addr" env:"LISTEN_ADDR" help:"Address the HTTP server listens on"`
+	CORSOrigins []string `toml:"cors_origins" env:"CORS_ALLOWED_ORIGINS" help:"Origins allowed to call the API from a browser, * allows all"`
+}
+
+type TLS struct {
+	Enabled                bool          `toml:"enabled" env:"TLS_ENABLED" help:"Serve HTTPS on server.addr instead of HTTP"`
+	CertFile               string        `toml:"cert_file" env:"TLS_CERT_FILE" help:"PEM certificate chain, reloaded when it changes or on SIGHUP"`
+	KeyFile                string        `toml:"key_file" env:"TLS_KEY_FILE" help:"PEM private key of the certificate"`
+	SelfSigned             bool          `toml:"self_signed" env:"TLS_SELF_SIGNED" help:"Create a self-signed certificate when cert_file and key_file do not exist"`
+	Hosts                  []string      `toml:"hosts" env:"TLS_HOSTS" help:"Names and IPs the self-signed certificate is valid for, the host name is added"`
+	ReloadInterval         time.Duration `toml:"reload_interval" env:"TLS_RELOAD_INTERVAL_SECONDS" help:"How often the certificate files are checked for changes"`
+	RedirectAddr           string        `toml:"redirect_addr" env:"TLS_REDIRECT_ADDR" help:"Address of a plain HTTP listener redirecting to HTTPS, empty disables it"`
+	HSTSMaxAge             time.Duration `toml:"hsts_max_age" env:"TLS_HSTS_MAX_AGE_SECONDS" help:"Strict-Transport-Security max-age, 0 disables the header"`
+	ClientCAFile           string        `toml:"client_ca_file" env:"TLS_CLIENT_CA_FILE" help:"PEM CA that signs client certificates, empty disables client certificates"`
+	ClientCertAccessLevels []string      `toml:"client_cert_access_levels" env:"TLS_CLIENT_CERT_ACCESS_LEVELS" help:"Access levels that have to present a client certificate when client_ca_file is set"`
+}
+
+type Database struct {
+	URL               string        `toml:"url" env:"DATABASE_URL" secret:"url" help:"PostgreSQL connection string, empty uses the PG* environment variables"`
+	DisableMigrations bool          `toml:"disable_migrations" env:"DISABLE_MIGRATIONS" help:"Do not apply the migrations on start"`
+	MonitorInterval   time.Duration `toml:"monitor_interval" env:"DB_MONITOR_INTERVAL_SECONDS" help:"How often the connection to the database is checked"`
+}
+
+type Log struct {
+	Level string `toml:"level" env:"LOG_LEVEL" help:"debug, info, warn or error"`
+}
+
+type Auth struct {
+	TokenSecret              string        `toml:"token_secret" env:"TOKEN_SECRET" secret:"true" help:"Key signing access tokens, empty generates one on every start"`
+	LoginMaxFailures         int           `toml:"login_max_failures" env:"LOGIN_MAX_FAILURES" help:"Failed logins after which an account or IP is locked"`
+	LoginLockout             time.Duration `toml:"login_lockout" env:"LOGIN_LOCKOUT_SECONDS" help:"How long a locked account or IP has to wait"`
+	PasswordMinLength        int           `toml:"password_min_length" env:"PASSWORD_MIN_LENGTH" help:"Minimum length of new passwords in characters"`
+	PasswordMinEntropyBits   float64       `toml:"password_min_entropy_bits" env:"PASSWORD_MIN_ENTROPY_BITS" help:"Minimum estimated entropy of new passwords"`
+	TOTPEnforcedAccessLevels []string      `toml:"totp_enforced_access_levels" env:"TOTP_ENFORCED_ACCESS_LEVELS" help:"Access levels that have to use TOTP, e.g. parent,superadmin"`
+}
+
+type Music struct {
+	Dir                 string        `toml:"dir" env:"MUSIC_DIR" help:"Directory holding the mp3 files"`
+	BufferSize          int           `toml:"buffer_size" env:"AUDIO_BUFFER_SIZE" help:"Bytes read from a file per write to the client"`
+	InitialBurst        time.Duration `toml:"initial_burst" env:"AUDIO_INITIAL_BURST_SECONDS" help:"Audio sent at full speed before streams are paced"`
+	LibraryScanInterval time.Duration `toml:"library_scan_interval" env:"LIBRARY_SCAN_INTERVAL_SECONDS" help:"How often the music directory is indexed"`
+}
+
+type Scheduler struct {
+	Interval time.Duration `toml:"interval" env:"SCHEDULER_INTERVAL_SECONDS" help:"How often recurring allowances are paid"`
+}
+
+type Health struct {
+	MinFreeDiskMB  uint64   `toml:"min_free_disk_mb" env:"HEALTH_MIN_FREE_DISK_MB" help:"Free space below which the music disk is reported degraded"`
+	CriticalChecks []string `toml:"critical_checks" env:"HEALTH_CRITICAL_CHECKS" help:"Checks whose failure makes /health/ready answer 503"`
+}
+
+type Metrics struct {
+	Addr string `toml:"addr" env:"METRICS_ADDR" help:"Address of the listener serving /metrics, empty disables it. It has no authentication, keep it off public networks"`
+}
+
+// Default returns the configuration used for everything not set otherwise.
+func Default() Config {
+	return Config{
+		Server: Server{Addr: ":8080", CORSOrigins: []string{"*"}},
+		TLS: TLS{
+			CertFile:               "tls/cert.pem",
+			KeyFile:                "tls/key.pem",
+			SelfSigned:             true,
+			Hosts:                  []string{"localhost", "127.0.0.1"},
+			ReloadInterval:         time.Minute,
+			HSTSMaxAge:             365 * 24 * time.Hour,
+			ClientCertAccessLevels: []string{string(models.Parent), string(models.Superadmin)},
+		},
+		Database: Database{MonitorInterval: 10 * time.Second},
+		Log:      Log{Level: "info"},
+		Auth: Auth{
+			LoginMaxFailures:       middleware.DefaultMaxLoginFailures,
+			LoginLockout:           middleware.DefaultLockoutDuration,
+			PasswordMinLength:      middleware.DefaultPasswordMinLength,
+			PasswordMinEntropyBits: middleware.DefaultPasswordMinEntropy,
+		},
+		Music: Music{
+			Dir:                 music.DefaultMusicDir,
+			BufferSize:          music.DefaultBufferSize,
+			InitialBurst:        music.DefaultInitialBurst,
+			LibraryScanInterval: 15 * time.Minute,
+		},
+		Scheduler: Scheduler{Interval: time.Hour},
+		Health:    Health{MinFreeDiskMB: 500, CriticalChecks: []string{"database"}},
+		Metrics:   Metrics{Addr: "127.0.0.1:9090"},
+	}
+}
+
+// LogLevel returns the parsed log level, Validate makes sure it is valid.
+func (c Config) LogLevel() slog.Level {
+	return middleware.ParseLogLevel(c.Log.Level)
+}
+
+// Validate returns all settings that are out of range.
+func (c Config) Validate() error {
+	var errs []error
+	invalid := func(key, format string, args ...any) {
+		errs = append(errs, fmt.Errorf("%s: %s", key, fmt.Sprintf(format, args...)))
+	}
+	if _, _, err := net.SplitHostPort(c.Server.Addr); err != nil {
+		invalid("server.addr", "%v", err)
+	}
+	if len(c.Server.CORSOrigins) == 0 {
+		invalid("server.cors_origins", "at least one origin is required, use * to allow all")
+	}
+	for _, origin := range c.Server.CORSOrigins {
+		if origin != "*" && !strings.HasPrefix(origin, "http://") && !strings.HasPrefix(origin, "https://") {
+			invalid("server.cors_origins", "%q is not an origin like https://example.com", origin)
+		}
+	}
+	if c.TLS.Enabled {
+		if c.TLS.CertFile == "" || c.TLS.KeyFile == "" {
+			invalid("tls.cert_file", "cert_file and key_file are required")
+		}
+		if c.TLS.RedirectAddr != "" {
+			if _, _, err := net.SplitHostPort(c.TLS.RedirectAddr); err != nil {
+				invalid("tls.redirect_addr", "%v", err)
+			} else if c.TLS.RedirectAddr == c.Server.Addr {
+				invalid("tls.redirect_addr", "must differ from server.addr")
+			}
+		}
+		if c.TLS.ReloadInterval <= 0 {
+			invalid("tls.reload_interval", "must be positive")
+		}
+		if c.TLS.HSTSMaxAge < 0 {
+			invalid("tls.hsts_max_age", "must not be negative")
+		}
+	} else if c.TLS.ClientCAFile != "" {
+		invalid("tls.client_ca_file", "client certificates need tls.enabled")
+	}
+	if c.Metrics.Addr != "" {
+		if _, _, err := net.SplitHostPort(c.Metrics.Addr); err != nil {
+			invalid("metrics.addr", "%v", err)
+		} else if c.Metrics.Addr == c.Server.Addr || c.TLS.Enabled && c.Metrics.Addr == c.TLS.RedirectAddr {
+			invalid("metrics.addr", "must differ from server.addr and tls.redirect_addr")
+		}
+	}
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(c.Log.Level)); err != nil {
+		invalid("log.level", "%q is not one of debug, info, warn or error", c.Log.Level)
+	}
+	if c.Auth.LoginMaxFailures < 1 {
+		invalid("auth.login_max_failures", "must be at least 1")
+	}
+	if c.Auth.PasswordMinLength < 1 {
+		invalid("auth.password_min_length", "must be at least 1")
+	}
+	if c.Auth.PasswordMinEntropyBits < 0 {
+		invalid("auth.password_min_entropy_bits", "must not be negative")
+	}
+	knownLevels := []models.AccessLevel{models.Parent, models.Child, models.Grandparent, models.Guest, models.Superadmin}
+	for key, levels := range map[string][]string{
+		"auth.totp_enforced_access_levels": c.Auth.TOTPEnforcedAccessLevels,
+		"tls.client_cert_access_levels":    c.TLS.ClientCertAccessLevels,
+	} {
+		for _, level := range levels {
+			if !slices.Contains(knownLevels, models.AccessLevel(level).Normalize()) {
+				invalid(key, "unknown access level %q", level)
+			}
+		}
+	}
+	if c.Music.Dir == "" {
+		invalid("music.dir", "must not be empty")
+	}
+	if c.Music.BufferSize < 512 {
+		invalid("music.buffer_size", "must be at least 512")
+	}
+	if c.Music.InitialBurst < 0 {
+		invalid("music.initial_burst", "must not be negative")
+	}
+	for key, d := range map[string]time.Duration{
+		"database.monitor_interval":   c.Database.MonitorInterval,
+		"auth.login_lockout":          c.Auth.LoginLockout,
+		"music.library_scan_interval": c.Music.LibraryScanInterval,
+		"scheduler.interval":          c.Scheduler.Interval,
+	} {
+		if d <= 0 {
+			invalid(key, "must be positive")
+		}
+	}
+	slices.SortFunc(errs, func(a, b error) int { return strings.Compare(a.Error(), b.Error()) })
+	return errors.Join(errs...)
+}
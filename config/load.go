@@ -0,0 +1,283 @@
+package config
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FileEnv names the config file when there is no -config flag.
+const FileEnv = "CONFIG_FILE"
+
+var durationType = reflect.TypeFor[time.Duration]()
+
+// field is a setting of Config together with its tags.
+type field struct {
+	key    string // section.name
+	env    string
+	help   string
+	secret string
+	value  reflect.Value
+}
+
+func fields(c *Config) []field {
+	var result []field
+	sections := reflect.ValueOf(c).Elem()
+	for i := range sections.NumField() {
+		section := sections.Field(i)
+		sectionName := sections.Type().Field(i).Tag.Get("toml")
+		for j := range section.NumField() {
+			tags := section.Type().Field(j).Tag
+			result = append(result, field{
+				key:    sectionName + "." + tags.Get("toml"),
+				env:    tags.Get("env"),
+				help:   tags.Get("help"),
+				secret: tags.Get("secret"),
+				value:  section.Field(j),
+			})
+		}
+	}
+	return result
+}
+
+// Load builds the configuration from the defaults, the config file, the environment and the flags in args.
+// The config file is given with -config or CONFIG_FILE. Errors name the offending setting.
+func Load(args []string) (Config, error) {
+	c := Default()
+	byKey := map[string]field{}
+	for _, f := range fields(&c) {
+		byKey[f.key] = f
+	}
+
+	flags := flag.NewFlagSet("homeApplications", flag.ContinueOnError)
+	file := flags.String("config", os.Getenv(FileEnv), "TOML file with the configuration")
+	flagValues := map[string]string{}
+	for _, f := range fields(&c) {
+		define := flags.Func
+		if f.value.Kind() == reflect.Bool {
+			// -tls.enabled is short for -tls.enabled=true
+			define = flags.BoolFunc
+		}
+		define(f.key, f.help, func(value string) error {
+			flagValues[f.key] = value
+			return nil
+		})
+	}
+	if err := flags.Parse(args); err != nil {
+		return c, err
+	}
+	if flags.NArg() > 0 {
+		return c, fmt.Errorf("unexpected argument %q", flags.Arg(0))
+	}
+
+	if *file != "" {
+		values, err := readFile(*file)
+		if err != nil {
+			return c, err
+		}
+		for key, value := range values {
+			f, ok := byKey[key]
+			if !ok {
+				return c, fmt.Errorf("%s: unknown setting %s", *file, key)
+			}
+			if err := set(f.value, value); err != nil {
+				return c, fmt.Errorf("%s: %s: %w", *file, key, err)
+			}
+		}
+	}
+	for _, f := range byKey {
+		if value := os.Getenv(f.env); f.env != "" && value != "" {
+			if err := set(f.value, value); err != nil {
+				return c, fmt.Errorf("%s: %w", f.env, err)
+			}
+		}
+	}
+	for key, value := range flagValues {
+		if err := set(byKey[key].value, value); err != nil {
+			return c, fmt.Errorf("-%s: %w", key, err)
+		}
+	}
+	return c, c.Validate()
+}
+
+// set parses value into v. Lists come from the file as []string and from env and flags comma separated.
+func set(v reflect.Value, value any) error {
+	if v.Kind() == reflect.Slice {
+		list, ok := value.([]string)
+		if !ok {
+			list = nil
+			for item := range strings.SplitSeq(value.(string), ",") {
+				if item = strings.TrimSpace(item); item != "" {
+					list = append(list, item)
+				}
+			}
+		}
+		v.Set(reflect.ValueOf(list))
+		return nil
+	}
+	s, ok := value.(string)
+	if !ok {
+		return errors.New("expected a single value, not a list")
+	}
+	switch {
+	case v.Type() == durationType:
+		// Whole seconds, as the *_SECONDS environment variables always were
+		if seconds, err := strconv.ParseFloat(s, 64); err == nil {
+			v.SetInt(int64(seconds * float64(time.Second)))
+			return nil
+		}
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return fmt.Errorf("%q is not a duration like 90s or 15m", s)
+		}
+		v.SetInt(int64(d))
+	case v.Kind() == reflect.String:
+		v.SetString(s)
+	case v.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return fmt.Errorf("%q is not true or false", s)
+		}
+		v.SetBool(b)
+	case v.Kind() == reflect.Int:
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			return fmt.Errorf("%q is not a whole number", s)
+		}
+		v.SetInt(int64(n))
+	case v.Kind() == reflect.Uint64:
+		n, err := strconv.ParseUint(s, 10, 64)
+		if err != nil {
+			return fmt.Errorf("%q is not a positive whole number", s)
+		}
+		v.SetUint(n)
+	case v.Kind() == reflect.Float64:
+		n, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return fmt.Errorf("%q is not a number", s)
+		}
+		v.SetFloat(n)
+	default:
+		panic("config: unsupported type " + v.Type().String())
+	}
+	return nil
+}
+
+func readFile(name string) (map[string]any, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	values, err := parseTOML(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return values, nil
+}
+
+// parseTOML reads the part of TOML the configuration needs: [sections] and key = value lines, where a value is
+// a string, a number, a boolean or a list of them on one line. Strings in lists must not contain commas.
+// Keys are returned as section.key.
+func parseTOML(r io.Reader) (map[string]any, error) {
+	values := map[string]any{}
+	section := ""
+	scanner := bufio.NewScanner(r)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(stripComment(scanner.Text()))
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "[") {
+			if !strings.HasSuffix(line, "]") {
+				return nil, fmt.Errorf("line %d: invalid section %s", lineNumber, line)
+			}
+			section = strings.TrimSpace(line[1 : len(line)-1])
+			continue
+		}
+		key, raw, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected key = value", lineNumber)
+		}
+		key = strings.TrimSpace(key)
+		if section != "" {
+			key = section + "." + key
+		}
+		if _, duplicate := values[key]; duplicate {
+			return nil, fmt.Errorf("line %d: %s is set twice", lineNumber, key)
+		}
+		value, err := parseValue(strings.TrimSpace(raw))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNumber, err)
+		}
+		values[key] = value
+	}
+	return values, scanner.Err()
+}
+
+// stripComment removes a # comment that is not inside a string.
+func stripComment(line string) string {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case quote == '"' && c == '\\':
+			i++ // skip the escaped character
+		case quote != 0 && c == quote:
+			quote = 0
+		case quote == 0 && (c == '"' || c == '\''):
+			quote = c
+		case quote == 0 && c == '#':
+			return line[:i]
+		}
+	}
+	return line
+}
+
+func parseValue(raw string) (any, error) {
+	if strings.HasPrefix(raw, "[") {
+		if !strings.HasSuffix(raw, "]") {
+			return nil, errors.New("lists have to be on one line")
+		}
+		list := []string{}
+		for item := range strings.SplitSeq(raw[1:len(raw)-1], ",") {
+			if item = strings.TrimSpace(item); item == "" {
+				continue
+			}
+			value, err := parseValue(item)
+			if err != nil {
+				return nil, err
+			}
+			s, ok := value.(string)
+			if !ok {
+				return nil, errors.New("lists cannot be nested")
+			}
+			list = append(list, s)
+		}
+		return list, nil
+	}
+	switch {
+	case strings.HasPrefix(raw, `"`):
+		s, err := strconv.Unquote(raw)
+		if err != nil {
+			return nil, fmt.Errorf("invalid string %s", raw)
+		}
+		return s, nil
+	case strings.HasPrefix(raw, "'"):
+		if len(raw) < 2 || !strings.HasSuffix(raw, "'") {
+			return nil, fmt.Errorf("invalid string %s", raw)
+		}
+		return raw[1 : len(raw)-1], nil
+	case raw == "":
+		return nil, errors.New("missing value")
+	}
+	// Numbers and booleans are parsed by set, which knows the type of the setting
+	return raw, nil
+}
@@ -0,0 +1,144 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseTOML(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    map[string]any
+		wantErr string
+	}{
+		{
+			name: "sections",
+			input: `# Server settings
+addr_without_section = ":1"
+[server]
+addr = ":8080"  # comment
+cors_origins = ["https://a.example", 'https://b.example', ]
+
+[ auth ]
+login_max_failures = 5
+token_secret = "with # hash and \"quotes\""
+[tls]
+enabled = true
+key_file = 'C:\keys\key.pem'
+hosts = []
+`,
+			want: map[string]any{
+				"addr_without_section":    ":1",
+				"server.addr":             ":8080",
+				"server.cors_origins":     []string{"https://a.example", "https://b.example"},
+				"auth.login_max_failures": "5",
+				"auth.token_secret":       `with # hash and "quotes"`,
+				"tls.enabled":             "true",
+				"tls.key_file":            `C:\keys\key.pem`,
+				"tls.hosts":               []string{},
+			},
+		},
+		{name: "empty", input: "\n# only a comment\n", want: map[string]any{}},
+		{name: "unterminated section", input: "[server\n", wantErr: "line 1: invalid section"},
+		{name: "no value", input: "[server]\naddr\n", wantErr: "line 2: expected key = value"},
+		{name: "missing value", input: "addr =\n", wantErr: "line 1: missing value"},
+		{name: "duplicate", input: "[log]\nlevel = 'info'\nlevel = 'debug'\n", wantErr: "line 3: log.level is set twice"},
+		{name: "unterminated string", input: `addr = "foo`, wantErr: "line 1: invalid string"},
+		{name: "unterminated literal", input: `addr = 'foo`, wantErr: "line 1: invalid string"},
+		{name: "multi-line list", input: "hosts = [\n'a']\n", wantErr: "line 1: lists have to be on one line"},
+		{name: "nested list", input: "hosts = [[1]]\n", wantErr: "line 1: lists cannot be nested"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseTOML(strings.NewReader(tt.input))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("parseTOML() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseTOML() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseTOML() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSet(t *testing.T) {
+	tests := []struct {
+		name    string
+		target  any
+		value   any
+		want    any
+		wantErr bool
+	}{
+		{name: "string", target: new(string), value: "info", want: "info"},
+		{name: "bool", target: new(bool), value: "true", want: true},
+		{name: "invalid bool", target: new(bool), value: "yes please", wantErr: true},
+		{name: "int", target: new(int), value: "42", want: 42},
+		{name: "invalid int", target: new(int), value: "4.2", wantErr: true},
+		{name: "uint64", target: new(uint64), value: "500", want: uint64(500)},
+		{name: "negative uint64", target: new(uint64), value: "-1", wantErr: true},
+		{name: "float", target: new(float64), value: "40.5", want: 40.5},
+		{name: "duration", target: new(time.Duration), value: "15m", want: 15 * time.Minute},
+		{name: "duration in seconds", target: new(time.Duration), value: "90", want: 90 * time.Second},
+		{name: "invalid duration", target: new(time.Duration), value: "soon", wantErr: true},
+		{name: "list from the file", target: new([]string), value: []string{"a", "b"}, want: []string{"a", "b"}},
+		{name: "comma separated list", target: new([]string), value: "a, b,,c ", want: []string{"a", "b", "c"}},
+		{name: "empty list", target: new([]string), value: "", want: []string(nil)},
+		{name: "list for a single value", target: new(string), value: []string{"a"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := reflect.ValueOf(tt.target).Elem()
+			err := set(v, tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("set(%v) error = %v, want error %v", tt.value, err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(v.Interface(), tt.want) {
+				t.Errorf("set(%v) = %#v, want %#v", tt.value, v.Interface(), tt.want)
+			}
+		})
+	}
+}
+
+func TestLoad(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "config.toml")
+	content := "[log]\nlevel = 'warn'\n[server]\naddr = ':9000'\n[music]\nbuffer_size = 8192\n"
+	if err := os.WriteFile(file, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv(FileEnv, file)
+	t.Setenv("LISTEN_ADDR", ":9001")
+	t.Setenv("LOG_LEVEL", "")
+
+	c, err := Load([]string{"-log.level=debug", "-tls.self_signed=false", "-tls.enabled"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// flags win over the environment, which wins over the file, which wins over the defaults
+	if c.Log.Level != "debug" || c.Server.Addr != ":9001" || c.Music.BufferSize != 8192 || c.Scheduler.Interval != time.Hour {
+		t.Errorf("Load() = %+v", c)
+	}
+	if !c.TLS.Enabled || c.TLS.SelfSigned {
+		t.Errorf("Load() TLS = %+v, want enabled without self-signed certificate", c.TLS)
+	}
+
+	if _, err := Load([]string{"-music.buffer_size=10"}); err == nil || !strings.Contains(err.Error(), "music.buffer_size") {
+		t.Errorf("Load() error = %v, want it to name music.buffer_size", err)
+	}
+	if _, err := Load([]string{"-scheduler.interval=often"}); err == nil || !strings.Contains(err.Error(), "-scheduler.interval") {
+		t.Errorf("Load() error = %v, want it to name -scheduler.interval", err)
+	}
+	if _, err := Load([]string{"-metrics.addr=:9001"}); err == nil || !strings.Contains(err.Error(), "metrics.addr") {
+		t.Errorf("Load() error = %v, want metrics.addr to clash with server.addr", err)
+	}
+}
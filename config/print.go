@@ -0,0 +1,83 @@
+package config
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const redacted = "[REDACTED]"
+
+var (
+	// dsnPassword also matches sslpassword, the passphrase of the client key
+	dsnPassword = regexp.MustCompile(`(password\s*=\s*)('(?:[^'\\]|\\.)*'|\S+)`)
+	// urlSecrets are the query parameters of a connection URL that hold passwords
+	urlSecrets = map[string]bool{"password": true, "sslpassword": true}
+)
+
+// Print writes the configuration as a TOML file that Load accepts. Secrets are redacted: fields tagged
+// secret:"true" completely, connection strings (secret:"url") only their passwords, wherever they are given.
+func Print(w io.Writer, c Config) error {
+	section := ""
+	for _, f := range fields(&c) {
+		name, key, _ := strings.Cut(f.key, ".")
+		if name != section {
+			if section != "" {
+				fmt.Fprintln(w)
+			}
+			section = name
+			fmt.Fprintf(w, "[%s]\n", section)
+		}
+		if _, err := fmt.Fprintf(w, "# %s\n%s = %s\n", f.help, key, format(f)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func format(f field) string {
+	v := f.value
+	switch {
+	case v.Type() == durationType:
+		return strconv.Quote(time.Duration(v.Int()).String())
+	case v.Kind() == reflect.String:
+		return strconv.Quote(redact(f.secret, v.String()))
+	case v.Kind() == reflect.Slice:
+		var items []string
+		for i := range v.Len() {
+			items = append(items, strconv.Quote(v.Index(i).String()))
+		}
+		return "[" + strings.Join(items, ", ") + "]"
+	}
+	return fmt.Sprint(v.Interface())
+}
+
+func redact(secret, value string) string {
+	switch {
+	case value == "" || secret == "":
+		return value
+	case secret == "url":
+		if u, err := url.Parse(value); err == nil && u.Scheme != "" {
+			// The order of the parameters is kept, url.Values would sort them
+			params := strings.Split(u.RawQuery, "&")
+			for i, param := range params {
+				key, _, _ := strings.Cut(param, "=")
+				if unescaped, err := url.QueryUnescape(key); err == nil {
+					key = unescaped
+				}
+				if urlSecrets[strings.ToLower(key)] {
+					params[i] = key + "=" + redacted
+				}
+			}
+			u.RawQuery = strings.Join(params, "&")
+			return u.Redacted()
+		}
+		return dsnPassword.ReplaceAllString(value, "${1}"+redacted)
+	}
+	return redacted
+}
@@ -0,0 +1,87 @@
+package config
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRedact(t *testing.T) {
+	tests := []struct {
+		name   string
+		secret string
+		value  string
+		want   string
+	}{
+		{name: "not secret", value: "info", want: "info"},
+		{name: "empty secret", secret: "true", value: "", want: ""},
+		{name: "secret", secret: "true", value: "S3cret", want: redacted},
+		{name: "URL without password", secret: "url", value: "postgres://app@db:5432/home", want: "postgres://app@db:5432/home"},
+		{name: "URL userinfo", secret: "url", value: "postgres://app:S3cret@db/home", want: "postgres://app:xxxxx@db/home"},
+		{
+			name: "URL query", secret: "url", value: "postgres://db/home?user=app&password=S3cret&sslmode=verify-full",
+			want: "postgres://db/home?user=app&password=" + redacted + "&sslmode=verify-full",
+		},
+		{
+			name: "URL escaped query key", secret: "url", value: "postgres://db/home?pass%77ord=S3cret",
+			want: "postgres://db/home?password=" + redacted,
+		},
+		{
+			name: "URL key passphrase", secret: "url", value: "postgres://app:S3cret@db/home?sslpassword=S3cret&sslmode=require",
+			want: "postgres://app:xxxxx@db/home?sslpassword=" + redacted + "&sslmode=require",
+		},
+		{name: "DSN", secret: "url", value: "host=db user=app password=S3cret dbname=home", want: "host=db user=app password=" + redacted + " dbname=home"},
+		{name: "DSN with spaces", secret: "url", value: "host=db password = S3cret", want: "host=db password = " + redacted},
+		{
+			name: "DSN quoted", secret: "url", value: `host=db password='S3 \'cret' sslpassword=S3cret`,
+			want: "host=db password=" + redacted + " sslpassword=" + redacted,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := redact(tt.secret, tt.value)
+			if got != tt.want {
+				t.Errorf("redact(%q) = %q, want %q", tt.value, got, tt.want)
+			}
+			if tt.secret != "" && strings.Contains(got, "S3") {
+				t.Errorf("redact(%q) = %q, the secret is visible", tt.value, got)
+			}
+		})
+	}
+}
+
+func TestPrint(t *testing.T) {
+	c := Default()
+	c.Auth.TokenSecret = "S3cret-token"
+	c.Database.URL = "postgres://app:S3cret-user@db/home?password=S3cret-query"
+	var out bytes.Buffer
+	if err := Print(&out, c); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(out.String(), "S3cret") {
+		t.Errorf("Print() shows a secret:\n%s", out.String())
+	}
+
+	// The output is a config file that Load accepts
+	values, err := parseTOML(&out)
+	if err != nil {
+		t.Fatalf("parseTOML(Print()) error = %v", err)
+	}
+	for key, want := range map[string]any{
+		"server.addr":        ":8080",
+		"auth.token_secret":  redacted,
+		"tls.hosts":          []string{"localhost", "127.0.0.1"},
+		"scheduler.interval": "1h0m0s",
+		"tls.enabled":        "false",
+	} {
+		if got := values[key]; !reflect.DeepEqual(got, want) {
+			t.Errorf("Print() %s = %#v, want %#v", key, got, want)
+		}
+	}
+	for _, f := range fields(&c) {
+		if _, ok := values[f.key]; !ok {
+			t.Errorf("Print() misses %s", f.key)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"homeApplications/middleware"
+	"homeApplications/models"
+)
+
+// Devices handles /devices: POST registers the client the user is logged in on and binds the session to it,
+// GET lists the devices of the user.
+// Admins may list the devices of another user of their household with ?userId=.
+// The returned token is sent as X-Device-Token, e.g. to allow PIN logins on a family tablet.
+func Devices(w http.ResponseWriter, r *http.Request) {
+	appUser, err := middleware.AuthenticateUser(r)
+	if err != nil {
+		middleware.WriteError(w, r, err)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		userID := appUser.ID
+		if v := r.URL.Query().Get("userId"); v != "" {
+			if userID, err = strconv.Atoi(v); err != nil {
+				middleware.WriteError(w, r, middleware.ErrInvalidUserID)
+				return
+			}
+		}
+		if userID != appUser.ID {
+			same, err := middleware.HouseholdScope(r.Context(), appUser).HasUser(r.Context(), userID)
+			if err != nil || !same || !middleware.HasPermission(r.Context(), appUser, models.PermUsersManage) {
+				middleware.WriteError(w, r, middleware.ErrForbidden)
+				return
+			}
+		}
+		devices, err := middleware.ListDevices(r.Context(), userID, appUser.DeviceID)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Failed to execute query", "error", err)
+			middleware.WriteError(w, r, middleware.ErrInternal)
+			return
+		}
+		json.NewEncoder(w).Encode(devices)
+	case http.MethodPost:
+		// A PIN session must not mint tokens for further devices
+		if appUser.AuthMethod == middleware.AuthMethodPIN {
+			middleware.WriteError(w, r, middleware.ErrForbidden)
+			return
+		}
+		var req models.DeviceRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || strings.TrimSpace(req.Name) == "" {
+			middleware.WriteError(w, r, middleware.ErrInvalidPayload)
+			return
+		}
+		registration, err := middleware.RegisterDevice(r.Context(), appUser, req.Name)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Failed to register device", "error", err)
+			middleware.WriteError(w, r, middleware.ErrInternal)
+			return
+		}
+		slog.InfoContext(r.Context(), "Device registered", "user", appUser, "deviceId", registration.ID, "deviceName", registration.Name)
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(registration)
+	default:
+		middleware.WriteError(w, r, middleware.ErrMethodNotAllowed)
+	}
+}
+
+// Device handles DELETE /devices/{id}: the device is revoked and all its sessions and audio URLs stop working.
+// Users revoke their own devices, admins every device of their household, e.g. a lost tablet.
+func Device(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		middleware.WriteError(w, r, middleware.ErrMethodNotAllowed)
+		return
+	}
+	appUser, err := middleware.AuthenticateUser(r)
+	if err != nil {
+		middleware.WriteError(w, r, err)
+		return
+	}
+
+	deviceID := r.PathValue("id")
+	asAdmin := middleware.HasPermission(r.Context(), appUser, models.PermUsersManage)
+	found, err := middleware.RevokeDevice(r.Context(), appUser, deviceID, asAdmin)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to revoke device", "error", err)
+		middleware.WriteError(w, r, middleware.ErrInternal)
+		return
+	}
+	if !found {
+		middleware.WriteError(w, r, middleware.NewError(http.StatusNotFound, "device_not_found", "Device not found"))
+		return
+	}
+	slog.InfoContext(r.Context(), "Device revoked", "user", appUser, "deviceId", deviceID)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,131 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// CheckFunc checks one component. The details are shown in /health/ready, an error marks the component DOWN.
+type CheckFunc func(ctx context.Context) (map[string]any, error)
+
+type check struct {
+	name string
+	run  CheckFunc
+}
+
+var (
+	dbPool *pgxpool.Pool
+
+	checksMu sync.RWMutex
+	checks   []check
+	critical = map[string]bool{"database": true}
+
+	heartbeatsMu sync.Mutex
+	heartbeats   = map[string]time.Time{}
+)
+
+func SetDBConnection(pool *pgxpool.Pool) {
+	dbPool = pool
+}
+
+// Register adds a check to /health/ready.
+func Register(name string, run CheckFunc) {
+	checksMu.Lock()
+	defer checksMu.Unlock()
+	checks = append(checks, check{name: name, run: run})
+}
+
+// SetCritical sets the checks whose failure makes the server not ready. Failures of all other checks
+// only degrade it. By default only the database is critical.
+func SetCritical(names []string) {
+	checksMu.Lock()
+	defer checksMu.Unlock()
+	critical = map[string]bool{}
+	for _, name := range names {
+		if name != "" {
+			critical[name] = true
+		}
+	}
+}
+
+// Beat records that the background job with the given name is alive, see HeartbeatCheck.
+func Beat(name string) {
+	heartbeatsMu.Lock()
+	defer heartbeatsMu.Unlock()
+	heartbeats[name] = time.Now()
+}
+
+// DatabaseCheck runs a trivial query and reports how long it took.
+func DatabaseCheck(ctx context.Context) (map[string]any, error) {
+	start := time.Now()
+	if _, err := dbPool.Exec(ctx, "SELECT 1"); err != nil {
+		return nil, err
+	}
+	return map[string]any{"queryLatencyMs": float64(time.Since(start).Microseconds()) / 1000}, nil
+}
+
+// MigrationsCheck reports the latest successfully applied migration.
+func MigrationsCheck(ctx context.Context) (map[string]any, error) {
+	var version, description string
+	var installedOn time.Time
+	err := dbPool.QueryRow(ctx, `SELECT version, description, installed_on FROM flyway_schema_history
+		WHERE success AND version IS NOT NULL ORDER BY installed_rank DESC LIMIT 1`).Scan(&version, &description, &installedOn)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, errors.New("no migration applied")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return map[string]any{"version": version, "description": description, "installedOn": installedOn}, nil
+}
+
+// DirectoryCheck checks that dir can be listed.
+func DirectoryCheck(dir string) CheckFunc {
+	return func(ctx context.Context) (map[string]any, error) {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]any{"path": dir, "entries": len(entries)}, nil
+	}
+}
+
+// DiskSpaceCheck fails when less than minFree bytes are available on the file system holding path.
+func DiskSpaceCheck(path string, minFree uint64) CheckFunc {
+	return func(ctx context.Context) (map[string]any, error) {
+		free, total, err := diskSpace(path)
+		if err != nil {
+			return nil, err
+		}
+		details := map[string]any{"path": path, "freeBytes": free, "totalBytes": total, "minFreeBytes": minFree}
+		if free < minFree {
+			return details, fmt.Errorf("only %d MiB free", free>>20)
+		}
+		return details, nil
+	}
+}
+
+// HeartbeatCheck fails when the job did not call Beat within maxAge.
+func HeartbeatCheck(name string, maxAge time.Duration) CheckFunc {
+	return func(ctx context.Context) (map[string]any, error) {
+		heartbeatsMu.Lock()
+		last, ok := heartbeats[name]
+		heartbeatsMu.Unlock()
+		if !ok {
+			return nil, errors.New("no heartbeat yet")
+		}
+		age := time.Since(last)
+		details := map[string]any{"lastBeat": last, "ageSeconds": int(age.Seconds()), "maxAgeSeconds": int(maxAge.Seconds())}
+		if age > maxAge {
+			return details, errors.New("heartbeat is overdue")
+		}
+		return details, nil
+	}
+}
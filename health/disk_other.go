@@ -0,0 +1,9 @@
+//go:build !(linux || darwin || freebsd || windows)
+
+package health
+
+import "errors"
+
+func diskSpace(path string) (free, total uint64, err error) {
+	return 0, 0, errors.ErrUnsupported
+}
@@ -1,17 +1,56 @@
 package health
 
 import (
+	"context"
 	"encoding/json"
+	"log/slog"
 	"net/http"
+	"sync"
+	"time"
 
 	"homeApplications/middleware"
-	"log"
+)
+
+// checkTimeout bounds every check of /health/ready, so a hanging component cannot hang the probe.
+const checkTimeout = 2 * time.Second
+
+// Status of the server and of its components.
+const (
+	StatusUp       = "UP"
+	StatusDegraded = "DEGRADED"
+	StatusDown     = "DOWN"
 )
 
 type HealthStatus struct {
 	Status string `json:"status"`
 }
 
+// Liveness is the body of /health/live.
+type Liveness struct {
+	Status        string  `json:"status"`
+	UptimeSeconds float64 `json:"uptimeSeconds"`
+}
+
+// Readiness is the body of /health/ready. The server is DOWN when a critical component is down
+// and DEGRADED when any other component is.
+type Readiness struct {
+	Status        string               `json:"status"`
+	Version       string               `json:"version"`
+	Commit        string               `json:"commit,omitempty"`
+	StartedAt     time.Time            `json:"startedAt"`
+	UptimeSeconds float64              `json:"uptimeSeconds"`
+	Components    map[string]Component `json:"components"`
+}
+
+type Component struct {
+	Status    string         `json:"status"`
+	Critical  bool           `json:"critical"`
+	LatencyMs float64        `json:"latencyMs"`
+	Details   map[string]any `json:"details,omitempty"`
+	Error     string         `json:"error,omitempty"`
+}
+
+// HealthCheck is the original health endpoint, kept for existing clients. It only reports the readiness flag.
 func HealthCheck(w http.ResponseWriter, r *http.Request) {
 	status := HealthStatus{Status: "OK"}
 	if !middleware.IsDBReady() {
@@ -19,6 +58,78 @@ func HealthCheck(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusServiceUnavailable)
 	}
 	if err := json.NewEncoder(w).Encode(status); err != nil {
-		log.Println("HealthCheck: failed to encode response:", err)
+		slog.ErrorContext(r.Context(), "Failed to encode health status", "error", err)
+	}
+}
+
+// Live handles GET /health/live: the process is up and serving requests, nothing else is checked.
+func Live(w http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(w).Encode(Liveness{Status: StatusUp, UptimeSeconds: uptime()})
+}
+
+// Ready handles GET /health/ready: it runs all registered checks in parallel and answers 503 when a critical one fails.
+func Ready(w http.ResponseWriter, r *http.Request) {
+	readiness := Readiness{
+		Status:        StatusUp,
+		Version:       Version,
+		Commit:        Commit,
+		StartedAt:     startedAt,
+		UptimeSeconds: uptime(),
+		Components:    runChecks(r.Context()),
+	}
+	for _, component := range readiness.Components {
+		if component.Status == StatusUp {
+			continue
+		}
+		if component.Critical {
+			readiness.Status = StatusDown
+			break
+		}
+		readiness.Status = StatusDegraded
+	}
+	if readiness.Status == StatusDown {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	if err := json.NewEncoder(w).Encode(readiness); err != nil {
+		slog.ErrorContext(r.Context(), "Failed to encode health status", "error", err)
 	}
 }
+
+func runChecks(ctx context.Context) map[string]Component {
+	checksMu.RLock()
+	registered := checks
+	isCritical := critical
+	checksMu.RUnlock()
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	components := make(map[string]Component, len(registered))
+	for _, c := range registered {
+		wg.Go(func() {
+			checkCtx, cancel := context.WithTimeout(ctx, checkTimeout)
+			defer cancel()
+			start := time.Now()
+			details, err := c.run(checkCtx)
+			component := Component{
+				Status:    StatusUp,
+				Critical:  isCritical[c.name],
+				LatencyMs: float64(time.Since(start).Microseconds()) / 1000,
+				Details:   details,
+			}
+			if err != nil {
+				component.Status = StatusDown
+				component.Error = err.Error()
+				slog.WarnContext(ctx, "Health check failed", "check", c.name, "error", err)
+			}
+			mu.Lock()
+			components[c.name] = component
+			mu.Unlock()
+		})
+	}
+	wg.Wait()
+	return components
+}
+
+func uptime() float64 {
+	return time.Since(startedAt).Round(time.Second).Seconds()
+}
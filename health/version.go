@@ -0,0 +1,31 @@
+package health
+
+import (
+	"runtime/debug"
+	"time"
+)
+
+// Version and Commit are set at build time:
+//
+//	go build -ldflags "-X homeApplications/health.Version=1.4.0 -X homeApplications/health.Commit=$(git rev-parse HEAD)"
+//
+// Without them the commit is taken from the VCS information Go embeds in the binary.
+var (
+	Version = "dev"
+	Commit  = ""
+)
+
+var startedAt = time.Now()
+
+func init() {
+	if Commit != "" {
+		return
+	}
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range info.Settings {
+			if setting.Key == "vcs.revision" {
+				Commit = setting.Value
+			}
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package households
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"homeApplications/middleware"
+	"homeApplications/models"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var (
+	dbPool *pgxpool.Pool
+)
+
+func SetDBConnection(pool *pgxpool.Pool) {
+	dbPool = pool
+}
+
+// Households handles /households: listing and creating households. Only superadmins manage households,
+// the users of a new household are added with POST /user and its HouseholdID.
+func Households(w http.ResponseWriter, r *http.Request) {
+	middleware.EnableCors(&w)
+	_, err := middleware.CheckAuthorization(r, models.PermHouseholdsManage)
+	if err != nil {
+		middleware.WriteError(w, r, err)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		listHouseholds(w, r)
+	case http.MethodPost:
+		createHousehold(w, r)
+	default:
+		middleware.WriteError(w, r, middleware.ErrMethodNotAllowed)
+	}
+}
+
+// Household handles /households/{id}: renaming (PATCH) and deleting (DELETE) a household.
+// A household can only be deleted once it has no users left.
+func Household(w http.ResponseWriter, r *http.Request) {
+	middleware.EnableCors(&w)
+	_, err := middleware.CheckAuthorization(r, models.PermHouseholdsManage)
+	if err != nil {
+		middleware.WriteError(w, r, err)
+		return
+	}
+	householdID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		middleware.WriteError(w, r, middleware.NewError(http.StatusBadRequest, "invalid_household_id", "Invalid household ID"))
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPatch:
+		renameHousehold(w, r, householdID)
+	case http.MethodDelete:
+		deleteHousehold(w, r, householdID)
+	default:
+		middleware.WriteError(w, r, middleware.ErrMethodNotAllowed)
+	}
+}
+
+func listHouseholds(w http.ResponseWriter, r *http.Request) {
+	rows, err := dbPool.Query(r.Context(), "SELECT id, name FROM households ORDER BY name")
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to execute query", "error", err)
+		middleware.WriteError(w, r, middleware.ErrInternal)
+		return
+	}
+	defer rows.Close()
+
+	households := []models.Household{}
+	for rows.Next() {
+		var household models.Household
+		if err := rows.Scan(&household.ID, &household.Name); err != nil {
+			slog.ErrorContext(r.Context(), "Failed to scan row", "error", err)
+			middleware.WriteError(w, r, middleware.ErrInternal)
+			return
+		}
+		households = append(households, household)
+	}
+	json.NewEncoder(w).Encode(households)
+}
+
+func createHousehold(w http.ResponseWriter, r *http.Request) {
+	var household models.Household
+	if err := json.NewDecoder(r.Body).Decode(&household); err != nil || strings.TrimSpace(household.Name) == "" {
+		middleware.WriteError(w, r, middleware.ErrInvalidPayload)
+		return
+	}
+	household.Name = strings.TrimSpace(household.Name)
+
+	err := dbPool.QueryRow(r.Context(), "INSERT INTO households (name) VALUES ($1) RETURNING id", household.Name).Scan(&household.ID)
+	if err != nil {
+		handleHouseholdError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(household)
+}
+
+func renameHousehold(w http.ResponseWriter, r *http.Request, householdID int) {
+	var household models.Household
+	if err := json.NewDecoder(r.Body).Decode(&household); err != nil || strings.TrimSpace(household.Name) == "" {
+		middleware.WriteError(w, r, middleware.ErrInvalidPayload)
+		return
+	}
+	household.ID = householdID
+	household.Name = strings.TrimSpace(household.Name)
+
+	tag, err := dbPool.Exec(r.Context(), "UPDATE households SET name=$1 WHERE id=$2", household.Name, householdID)
+	if err != nil {
+		handleHouseholdError(w, r, err)
+		return
+	}
+	if tag.RowsAffected() == 0 {
+		middleware.WriteError(w, r, middleware.NewError(http.StatusNotFound, "household_not_found", "Household not found"))
+		return
+	}
+	json.NewEncoder(w).Encode(household)
+}
+
+func deleteHousehold(w http.ResponseWriter, r *http.Request, householdID int) {
+	tag, err := dbPool.Exec(r.Context(), "DELETE FROM households WHERE id=$1", householdID)
+	if err != nil {
+		handleHouseholdError(w, r, err)
+		return
+	}
+	if tag.RowsAffected() == 0 {
+		middleware.WriteError(w, r, middleware.NewError(http.StatusNotFound, "household_not_found", "Household not found"))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func handleHouseholdError(w http.ResponseWriter, r *http.Request, err error) {
+	pgErr, ok := errors.AsType[*pgconn.PgError](err)
+	switch {
+	case ok && pgErr.Code == "23505": // 23505 is the PostgreSQL error code for unique constraint violation
+		middleware.WriteError(w, r, middleware.NewError(http.StatusConflict, "household_exists", "Household already exists"))
+	case ok && pgErr.Code == "23503": // 23503 is the PostgreSQL error code for foreign key violation
+		middleware.WriteError(w, r, middleware.NewError(http.StatusConflict, "household_not_empty", "Household still has users"))
+	default:
+		slog.ErrorContext(r.Context(), "Failed to execute query", "error", err)
+		middleware.WriteError(w, r, middleware.ErrInternal)
+	}
+}
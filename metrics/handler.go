@@ -0,0 +1,39 @@
+package metrics
+
+import (
+	"log/slog"
+	"net/http"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// ContentType is the version 0.0.4 text exposition format understood by every Prometheus server.
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// Handler serves GET /metrics for Prometheus to scrape.
+func Handler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", ContentType)
+	if err := WriteAll(w); err != nil {
+		slog.DebugContext(r.Context(), "Failed to write metrics", "error", err)
+	}
+}
+
+// RegisterDBPool exposes the statistics of the connection pool.
+func RegisterDBPool(pool *pgxpool.Pool) {
+	NewGaugeFunc("homeapp_db_pool_acquired_connections", "Connections currently in use.",
+		func() float64 { return float64(pool.Stat().AcquiredConns()) })
+	NewGaugeFunc("homeapp_db_pool_idle_connections", "Connections currently idle.",
+		func() float64 { return float64(pool.Stat().IdleConns()) })
+	NewGaugeFunc("homeapp_db_pool_total_connections", "Connections currently open.",
+		func() float64 { return float64(pool.Stat().TotalConns()) })
+	NewGaugeFunc("homeapp_db_pool_max_connections", "Maximum size of the pool.",
+		func() float64 { return float64(pool.Stat().MaxConns()) })
+	NewCounterFunc("homeapp_db_pool_acquires_total", "Successful connection acquires.",
+		func() float64 { return float64(pool.Stat().AcquireCount()) })
+	NewCounterFunc("homeapp_db_pool_empty_acquires_total", "Acquires that had to wait because no connection was idle.",
+		func() float64 { return float64(pool.Stat().EmptyAcquireCount()) })
+	NewCounterFunc("homeapp_db_pool_acquire_wait_seconds_total", "Time spent acquiring connections.",
+		func() float64 { return pool.Stat().AcquireDuration().Seconds() })
+	NewCounterFunc("homeapp_db_pool_canceled_acquires_total", "Acquires canceled by their context.",
+		func() float64 { return float64(pool.Stat().CanceledAcquireCount()) })
+}
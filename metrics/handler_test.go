@@ -0,0 +1,29 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHandler(t *testing.T) {
+	gauge := NewGauge("test_handler_streams", "Streams.")
+	gauge.Inc()
+	gauge.Inc()
+	gauge.Dec()
+	NewCounterFunc("test_handler_reads_total", "Reads.", func() float64 { return 7 })
+
+	w := httptest.NewRecorder()
+	Handler(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if got := w.Header().Get("Content-Type"); got != ContentType {
+		t.Errorf("Content-Type = %q, want %q", got, ContentType)
+	}
+	body := w.Body.String()
+	// Families are written in the order they were registered
+	want := "# HELP test_handler_streams Streams.\n# TYPE test_handler_streams gauge\ntest_handler_streams 1\n" +
+		"# HELP test_handler_reads_total Reads.\n# TYPE test_handler_reads_total counter\ntest_handler_reads_total 7\n"
+	if !strings.Contains(body, want) {
+		t.Errorf("Handler() =\n%s\nwant it to contain\n%s", body, want)
+	}
+}
@@ -0,0 +1,87 @@
+package metrics
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestHistogramVec(t *testing.T) {
+	h := &HistogramVec{name: "test_latency_seconds", help: "Latency.", series: series{labels: []string{"route"}},
+		buckets: []float64{0.1, 0.5, 1}, values: map[string]*histogram{}}
+	for _, v := range []float64{0.05, 0.1, 0.3, 0.7, 2} {
+		h.Observe(v, "/b")
+	}
+	h.Observe(0.2, "/a")
+
+	var out strings.Builder
+	h.write(&out)
+	want := `# HELP test_latency_seconds Latency.
+# TYPE test_latency_seconds histogram
+test_latency_seconds_bucket{route="/a",le="0.1"} 0
+test_latency_seconds_bucket{route="/a",le="0.5"} 1
+test_latency_seconds_bucket{route="/a",le="1"} 1
+test_latency_seconds_bucket{route="/a",le="+Inf"} 1
+test_latency_seconds_sum{route="/a"} 0.2
+test_latency_seconds_count{route="/a"} 1
+test_latency_seconds_bucket{route="/b",le="0.1"} 2
+test_latency_seconds_bucket{route="/b",le="0.5"} 3
+test_latency_seconds_bucket{route="/b",le="1"} 4
+test_latency_seconds_bucket{route="/b",le="+Inf"} 5
+test_latency_seconds_sum{route="/b"} 3.15
+test_latency_seconds_count{route="/b"} 5
+`
+	if out.String() != want {
+		t.Errorf("write() =\n%s\nwant\n%s", out.String(), want)
+	}
+}
+
+func TestCounterVec(t *testing.T) {
+	c := &CounterVec{name: "test_requests_total", help: "Requests.", series: series{labels: []string{"method", "path"}},
+		values: map[string]float64{}}
+	c.Inc("POST", "/b")
+	c.Inc("GET", `C:\music\"x"`+"\n")
+	c.Add(2.5, "GET", "/a")
+	c.Add(-1, "GET", "/a")
+	c.Inc("GET", "/a")
+
+	var out strings.Builder
+	c.write(&out)
+	// The series are sorted by their label values, whatever order they were created in
+	want := `# HELP test_requests_total Requests.
+# TYPE test_requests_total counter
+test_requests_total{method="GET",path="/a"} 3.5
+test_requests_total{method="GET",path="C:\\music\\\"x\"\n"} 1
+test_requests_total{method="POST",path="/b"} 1
+`
+	if out.String() != want {
+		t.Errorf("write() =\n%s\nwant\n%s", out.String(), want)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("Inc() with the wrong number of label values did not panic")
+		}
+	}()
+	c.Inc("GET")
+}
+
+func TestFormatFloat(t *testing.T) {
+	tests := []struct {
+		value float64
+		want  string
+	}{
+		{value: 0, want: "0"},
+		{value: 42, want: "42"},
+		{value: 0.25, want: "0.25"},
+		{value: 1e21, want: "1e+21"},
+		{value: math.Inf(1), want: "+Inf"},
+		{value: math.Inf(-1), want: "-Inf"},
+		{value: math.NaN(), want: "NaN"},
+	}
+	for _, tt := range tests {
+		if got := formatFloat(tt.value); got != tt.want {
+			t.Errorf("formatFloat(%v) = %s, want %s", tt.value, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,196 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"homeApplications/models"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// DeviceTokenHeader identifies a registered device. The token is handed out once by RegisterDevice.
+const DeviceTokenHeader = "X-Device-Token"
+
+// deviceStatusTTL is how long StreamMusic trusts a cached device status before asking the database again.
+const deviceStatusTTL = time.Minute
+
+type device struct {
+	id          string
+	householdID int
+}
+
+type deviceStatus struct {
+	active    bool
+	checkedAt time.Time
+}
+
+var (
+	deviceStatusMu sync.Mutex
+	deviceStatuses = map[string]deviceStatus{}
+)
+
+// RegisterDevice registers the client the user is currently using and returns its token. The session of the
+// request is bound to the new device unless it already is, so revoking the device ends it and its refresh token.
+// From then on the session is only accepted together with the returned token.
+func RegisterDevice(ctx context.Context, user models.AppUser, name string) (models.DeviceRegistration, error) {
+	token, err := randomToken()
+	if err != nil {
+		return models.DeviceRegistration{}, err
+	}
+	registration := models.DeviceRegistration{ID: uuid.New().String(), Name: strings.TrimSpace(name), DeviceToken: token}
+	tx, err := dbPool.Begin(ctx)
+	if err != nil {
+		return models.DeviceRegistration{}, err
+	}
+	defer tx.Rollback(ctx)
+	_, err = tx.Exec(ctx, "INSERT INTO devices (id, user_id, household_id, name, token_hash) VALUES ($1, $2, $3, $4, $5)",
+		registration.ID, user.ID, user.HouseholdID, registration.Name, hashToken(token))
+	if err != nil {
+		return models.DeviceRegistration{}, err
+	}
+	if user.SessionID != "" {
+		_, err = tx.Exec(ctx, "UPDATE sessions SET device_id=$1 WHERE id=$2 AND device_id IS NULL", registration.ID, user.SessionID)
+		if err != nil {
+			return models.DeviceRegistration{}, err
+		}
+	}
+	return registration, tx.Commit(ctx)
+}
+
+// deviceFromRequest looks up the registered device sending the request. It returns ErrUnknownDevice
+// when the request has no token or the device was revoked.
+func deviceFromRequest(ctx context.Context, r *http.Request) (device, error) {
+	var d device
+	token := r.Header.Get(DeviceTokenHeader)
+	if token == "" {
+		return d, ErrUnknownDevice
+	}
+	err := dbPool.QueryRow(ctx, "SELECT id, household_id FROM devices WHERE token_hash=$1 AND revoked_at IS NULL", hashToken(token)).
+		Scan(&d.id, &d.householdID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return d, ErrUnknownDevice
+	}
+	return d, err
+}
+
+// BindDevice binds the login to the device whose token is sent with the request, if any.
+// The device has to belong to the household of the user. A password login without device token starts unbound
+// and is bound by RegisterDevice when the client registers itself. PIN logins always are bound.
+func BindDevice(r *http.Request, user *models.AppUser) error {
+	if r.Header.Get(DeviceTokenHeader) == "" {
+		return nil
+	}
+	d, err := deviceFromRequest(r.Context(), r)
+	if err != nil {
+		return err
+	}
+	if d.householdID != user.HouseholdID {
+		return ErrUnknownDevice
+	}
+	user.DeviceID = d.id
+	touchDevice(r.Context(), d.id, clientIP(r))
+	return nil
+}
+
+// touchDevice records when and from where a device was last used. Unless the IP changed, it writes at most once a minute.
+func touchDevice(ctx context.Context, deviceID, ip string) {
+	_, err := dbPool.Exec(ctx, `UPDATE devices SET last_seen_at=NOW(), last_ip=$2
+		WHERE id=$1 AND (last_seen_at IS NULL OR last_seen_at < NOW() - INTERVAL '1 minute' OR last_ip IS DISTINCT FROM $2)`, deviceID, ip)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to update device", "error", err)
+	}
+}
+
+// ListDevices returns the devices of a user, the current one is marked.
+func ListDevices(ctx context.Context, userID int, currentDeviceID string) ([]models.Device, error) {
+	rows, err := dbPool.Query(ctx, `SELECT id, user_id, name, created_at, last_seen_at, last_ip, revoked_at
+		FROM devices WHERE user_id=$1 ORDER BY revoked_at NULLS FIRST, last_seen_at DESC NULLS LAST`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	devices := []models.Device{}
+	for rows.Next() {
+		var d models.Device
+		if err := rows.Scan(&d.ID, &d.UserID, &d.Name, &d.CreatedAt, &d.LastSeenAt, &d.LastIP, &d.RevokedAt); err != nil {
+			return nil, err
+		}
+		d.Current = d.ID == currentDeviceID
+		devices = append(devices, d)
+	}
+	return devices, rows.Err()
+}
+
+// RevokeDevice revokes a device together with all its sessions. Users revoke their own devices,
+// admins (asAdmin) every device of their households. It returns false when there is no such active device.
+func RevokeDevice(ctx context.Context, user models.AppUser, deviceID string, asAdmin bool) (bool, error) {
+	if uuid.Validate(deviceID) != nil {
+		return false, nil
+	}
+	tx, err := dbPool.Begin(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback(ctx)
+
+	condition, household := HouseholdScope(ctx, user).Where("household_id", 4)
+	tag, err := tx.Exec(ctx, `UPDATE devices SET revoked_at=NOW()
+		WHERE id=$1 AND revoked_at IS NULL AND (user_id=$2 OR ($3 AND `+condition+`))`, deviceID, user.ID, asAdmin, household)
+	if err != nil || tag.RowsAffected() == 0 {
+		return false, err
+	}
+	if _, err := tx.Exec(ctx, "UPDATE sessions SET revoked_at=NOW() WHERE device_id=$1 AND revoked_at IS NULL", deviceID); err != nil {
+		return false, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return false, err
+	}
+	setDeviceStatus(deviceID, false)
+	return true, nil
+}
+
+// DeviceActive reports whether a device has not been revoked. It is used for signed audio URLs, which work without
+// the database, so the answer is cached and an unknown device is assumed active while the database is unavailable.
+func DeviceActive(ctx context.Context, deviceID string) bool {
+	deviceStatusMu.Lock()
+	status, known := deviceStatuses[deviceID]
+	deviceStatusMu.Unlock()
+	if known && time.Since(status.checkedAt) < deviceStatusTTL {
+		return status.active
+	}
+	if !IsDBReady() {
+		return !known || status.active
+	}
+
+	var revoked bool
+	err := dbPool.QueryRow(ctx, "SELECT revoked_at IS NOT NULL FROM devices WHERE id=$1", deviceID).Scan(&revoked)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		slog.ErrorContext(ctx, "Failed to check device", "error", err)
+		return !known || status.active
+	}
+	// A deleted device is as good as a revoked one
+	active := err == nil && !revoked
+	setDeviceStatus(deviceID, active)
+	return active
+}
+
+func setDeviceStatus(deviceID string, active bool) {
+	deviceStatusMu.Lock()
+	defer deviceStatusMu.Unlock()
+	now := time.Now()
+	// Revoked devices stay in the cache so they remain blocked while the database is unavailable
+	for id, status := range deviceStatuses {
+		if status.active && now.Sub(status.checkedAt) > deviceStatusTTL {
+			delete(deviceStatuses, id)
+		}
+	}
+	deviceStatuses[deviceID] = deviceStatus{active: active, checkedAt: now}
+}
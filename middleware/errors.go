@@ -0,0 +1,124 @@
+package middleware
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"homeApplications/models"
+
+	"github.com/google/uuid"
+)
+
+// ContentTypeProblem is the media type of error responses, see RFC 7807.
+const ContentTypeProblem = "application/problem+json"
+
+// RequestIDHeader carries the ID of a request, it is echoed in the response and in problem details.
+const RequestIDHeader = "X-Request-ID"
+
+// Error is an error that knows how it is presented to the client. Code is stable, clients translate it,
+// Message is the English text and Details optional data such as the violated password rules.
+type Error struct {
+	Status  int
+	Code    string
+	Message string
+	Details any
+}
+
+func NewError(status int, code, message string) *Error {
+	return &Error{Status: status, Code: code, Message: message}
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// Is matches errors with the same status and code, so errors.Is works on copies made by WithDetails.
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Status == e.Status && t.Code == e.Code
+}
+
+// WithDetails returns a copy of the error with details attached.
+func (e *Error) WithDetails(details any) *Error {
+	c := *e
+	c.Details = details
+	return &c
+}
+
+// Errors shared by the handlers of all packages.
+var (
+	ErrInvalidPayload     = NewError(http.StatusBadRequest, "invalid_payload", "Invalid request payload")
+	ErrInvalidUserID      = NewError(http.StatusBadRequest, "invalid_user_id", "Invalid User ID")
+	ErrUserNotFound       = NewError(http.StatusNotFound, "user_not_found", "User not found")
+	ErrUnauthorized       = NewError(http.StatusUnauthorized, "unauthorized", "Authentication required")
+	ErrForbidden          = NewError(http.StatusForbidden, "forbidden", "Unauthorized access")
+	ErrMethodNotAllowed   = NewError(http.StatusMethodNotAllowed, "method_not_allowed", "Method not allowed")
+	ErrInternal           = NewError(http.StatusInternalServerError, "internal_error", "Internal server error")
+	ErrServiceUnavailable = NewError(http.StatusServiceUnavailable, "service_unavailable", "Service unavailable")
+)
+
+// Errors of the authentication.
+var (
+	ErrInvalidCredentials        = NewError(http.StatusUnauthorized, "invalid_credentials", "Invalid username or password")
+	ErrTokenExpired              = NewError(http.StatusUnauthorized, "token_expired", "Access token expired, refresh it")
+	ErrInvalidPIN                = NewError(http.StatusUnauthorized, "invalid_pin", "Invalid PIN")
+	ErrTOTPRequired              = NewError(http.StatusUnauthorized, "totp_required", "TOTP or recovery code required")
+	ErrInvalidSecondFactor       = NewError(http.StatusUnauthorized, "invalid_second_factor", "Invalid TOTP or recovery code")
+	ErrSecondFactorRequired      = NewError(http.StatusUnauthorized, "second_factor_required", "Second factor required, use /login")
+	ErrTOTPEnrollmentRequired    = NewError(http.StatusForbidden, "totp_enrollment_required", "TOTP enrollment required")
+	ErrTOTPEnforced              = NewError(http.StatusForbidden, "totp_enforced", "TOTP is enforced for your role")
+	ErrTOTPAlreadyEnabled        = NewError(http.StatusConflict, "totp_already_enabled", "TOTP is already enabled")
+	ErrTOTPNotEnrolled           = NewError(http.StatusConflict, "totp_not_enrolled", "TOTP is not enrolled")
+	ErrPasswordChangeRequired    = NewError(http.StatusForbidden, "password_change_required", "Password change required")
+	ErrUnknownDevice             = NewError(http.StatusForbidden, "unknown_device", "Unknown device")
+	ErrClientCertificateRequired = NewError(http.StatusForbidden, "client_certificate_required", "Client certificate required")
+)
+
+// WriteError answers with the problem details of err. Errors that are neither an *Error nor a
+// TooManyAttemptsError are logged and hidden behind a generic 500.
+func WriteError(w http.ResponseWriter, r *http.Request, err error) {
+	apiErr, ok := errors.AsType[*Error](err)
+	if tooMany, isTooMany := errors.AsType[*TooManyAttemptsError](err); isTooMany {
+		writeRetryAfter(w, tooMany.RetryAfter)
+		apiErr = NewError(http.StatusTooManyRequests, "too_many_attempts", "Too many attempts, try again later").
+			WithDetails(map[string]int{"retryAfterSeconds": int((tooMany.RetryAfter + time.Second - 1) / time.Second)})
+	} else if !ok {
+		slog.ErrorContext(r.Context(), "Unexpected error", "error", err)
+		apiErr = ErrInternal
+	}
+
+	problem := models.Problem{
+		Type:      "about:blank",
+		Title:     http.StatusText(apiErr.Status),
+		Status:    apiErr.Status,
+		Detail:    apiErr.Message,
+		Instance:  r.URL.Path,
+		Code:      apiErr.Code,
+		Details:   apiErr.Details,
+		RequestID: requestID(w, r),
+	}
+	h := w.Header()
+	// Headers meant for a successful response must not describe the problem
+	h.Del("Content-Length")
+	if apiErr.Status != http.StatusRequestedRangeNotSatisfiable {
+		h.Del("Content-Range")
+	}
+	h.Del("Content-Disposition")
+	h.Set("Content-Type", ContentTypeProblem)
+	h.Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(apiErr.Status)
+	json.NewEncoder(w).Encode(problem)
+}
+
+// requestID returns the ID assigned by RequestLogger. Without it, e.g. in tests, a new one is added to the response.
+func requestID(w http.ResponseWriter, r *http.Request) string {
+	if id := RequestID(r.Context()); id != "" {
+		return id
+	}
+	id := uuid.New().String()
+	w.Header().Set(RequestIDHeader, id)
+	return id
+}
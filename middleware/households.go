@@ -0,0 +1,50 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+
+	"homeApplications/models"
+)
+
+// Scope is the set of households a request works on. It is built from the authenticated user, whose household
+// was loaded together with the user, so handlers never look it up themselves. Every query touching data of
+// another user is limited with Where, so every household only sees its own data.
+type Scope struct {
+	// HouseholdID is the household of the user, the default for new data
+	HouseholdID int
+	// all is set for superadmins, who reach every household
+	all bool
+}
+
+// HouseholdScope returns the households user may manage: their own, or all of them with PermHouseholdsManage.
+func HouseholdScope(ctx context.Context, user models.AppUser) Scope {
+	return Scope{HouseholdID: user.HouseholdID, all: HasPermission(ctx, user, models.PermHouseholdsManage)}
+}
+
+// OwnHousehold returns the household of user only. It is used for data like pocket money and playlists,
+// which superadmins only see in their own household.
+func OwnHousehold(user models.AppUser) Scope {
+	return Scope{HouseholdID: user.HouseholdID}
+}
+
+// Includes reports whether householdID is part of the scope.
+func (s Scope) Includes(householdID int) bool {
+	return s.all || householdID == s.HouseholdID
+}
+
+// Where returns a condition limiting the household column to the scope and the argument for its placeholder $n.
+func (s Scope) Where(column string, n int) (string, any) {
+	if s.all {
+		return fmt.Sprintf("($%d::int IS NULL OR %s=$%[1]d)", n, column), nil
+	}
+	return fmt.Sprintf("%s=$%d", column, n), s.HouseholdID
+}
+
+// HasUser reports whether the user with userID belongs to a household of the scope.
+func (s Scope) HasUser(ctx context.Context, userID int) (bool, error) {
+	condition, arg := s.Where("household_id", 2)
+	var found bool
+	err := dbPool.QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM users WHERE id=$1 AND "+condition+")", userID, arg).Scan(&found)
+	return found, err
+}
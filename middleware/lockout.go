@@ -0,0 +1,229 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"homeApplications/models"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Defaults for the login throttle, see SetLoginThrottle.
+const (
+	DefaultMaxLoginFailures = 5
+	DefaultLockoutDuration  = 15 * time.Minute
+	loginBaseDelay          = time.Second
+	loginMaxDelay           = time.Minute
+)
+
+// dummyHash is compared against when the username does not exist, so unknown and known users take equally long.
+var dummyHash, _ = HashPassword("not a real password")
+
+// TooManyAttemptsError is returned while a username or client IP has to wait before the next login attempt.
+type TooManyAttemptsError struct {
+	RetryAfter time.Duration
+}
+
+func (e *TooManyAttemptsError) Error() string {
+	return "too many attempts"
+}
+
+type loginAttempts struct {
+	failures     int
+	last         time.Time
+	blockedUntil time.Time
+}
+
+// loginThrottle counts failed logins per username and per client IP. Every failure doubles the delay before
+// the next attempt, after maxFailures the key is locked out. Failures are forgotten after a lockout period without any.
+type loginThrottle struct {
+	mu          sync.Mutex
+	attempts    map[string]*loginAttempts
+	maxFailures int
+	lockout     time.Duration
+}
+
+var throttle = &loginThrottle{
+	attempts:    make(map[string]*loginAttempts),
+	maxFailures: DefaultMaxLoginFailures,
+	lockout:     DefaultLockoutDuration,
+}
+
+// SetLoginThrottle configures after how many failed logins an account or IP is locked and for how long.
+func SetLoginThrottle(maxFailures int, lockout time.Duration) {
+	throttle.mu.Lock()
+	defer throttle.mu.Unlock()
+	if maxFailures > 0 {
+		throttle.maxFailures = maxFailures
+	}
+	if lockout > 0 {
+		throttle.lockout = lockout
+	}
+}
+
+func userKey(username string) string { return "user:" + username }
+func ipKey(ip string) string         { return "ip:" + ip }
+
+// wait returns how long the keys still have to wait before the next attempt is accepted.
+func (t *loginThrottle) wait(now time.Time, keys ...string) time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var longest time.Duration
+	for _, key := range keys {
+		attempts, ok := t.attempts[key]
+		if !ok {
+			continue
+		}
+		next := attempts.blockedUntil
+		if attempts.failures > 0 {
+			delay := min(loginBaseDelay<<(attempts.failures-1), loginMaxDelay)
+			next = later(next, attempts.last.Add(delay))
+		}
+		longest = max(longest, next.Sub(now))
+	}
+	return longest
+}
+
+// failure records a failed attempt and returns the failure count and whether the key is now locked out.
+func (t *loginThrottle) failure(now time.Time, key string) (int, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	attempts, ok := t.attempts[key]
+	if !ok || now.Sub(attempts.last) > t.lockout {
+		t.prune(now)
+		attempts = &loginAttempts{}
+		t.attempts[key] = attempts
+	}
+	attempts.failures++
+	attempts.last = now
+	if attempts.failures < t.maxFailures {
+		return attempts.failures, false
+	}
+	failures := attempts.failures
+	attempts.failures = 0
+	attempts.blockedUntil = now.Add(t.lockout)
+	return failures, true
+}
+
+func (t *loginThrottle) reset(key string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.attempts, key)
+}
+
+// prune drops keys without recent failures so the map does not grow with every scanned username.
+func (t *loginThrottle) prune(now time.Time) {
+	for key, attempts := range t.attempts {
+		if now.Sub(attempts.last) > t.lockout && now.After(attempts.blockedUntil) {
+			delete(t.attempts, key)
+		}
+	}
+}
+
+func later(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
+
+// clientIP returns the address of the connecting client. Forwarded headers are ignored because they can be spoofed.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// recordLoginFailure counts a failed login for the username and the IP and persists the resulting lockouts.
+// userID is 0 when the username does not exist.
+func recordLoginFailure(ctx context.Context, userID int, username, ip string) {
+	now := time.Now()
+	if failures, locked := throttle.failure(now, userKey(username)); locked {
+		until := now.Add(throttle.lockout)
+		slog.WarnContext(ctx, "Login locked", "username", username, "until", until, "failures", failures)
+		if userID != 0 {
+			if _, err := dbPool.Exec(ctx, "UPDATE users SET locked_until=$1 WHERE id=$2", until, userID); err != nil {
+				slog.ErrorContext(ctx, "Failed to lock user", "error", err)
+			}
+		}
+		saveLockoutEvent(ctx, userID, username, ip, "username", failures, until)
+	}
+	if failures, locked := throttle.failure(now, ipKey(ip)); locked {
+		until := now.Add(throttle.lockout)
+		slog.WarnContext(ctx, "Logins from IP locked", "ip", ip, "until", until, "failures", failures)
+		saveLockoutEvent(ctx, userID, username, ip, "ip", failures, until)
+	}
+}
+
+func saveLockoutEvent(ctx context.Context, userID int, username, ip, reason string, failures int, until time.Time) {
+	var user *int
+	if userID != 0 {
+		user = &userID
+	}
+	_, err := dbPool.Exec(ctx, `INSERT INTO lockout_events (user_id, username, ip_address, reason, failures, locked_until)
+		VALUES ($1, $2, $3, $4, $5, $6)`, user, username, ip, reason, failures, until)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to save lockout event", "error", err)
+	}
+}
+
+// UnlockUser lifts the lockout of a user of the admin's households and marks the open lockout events as unlocked.
+// It returns false when there is no such user.
+func UnlockUser(ctx context.Context, admin models.AppUser, userID int) (bool, error) {
+	condition, household := HouseholdScope(ctx, admin).Where("household_id", 2)
+	var username string
+	err := dbPool.QueryRow(ctx, "UPDATE users SET locked_until=NULL, pin_locked_until=NULL WHERE id=$1 AND "+condition+" RETURNING name",
+		userID, household).Scan(&username)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return false, nil
+		}
+		return false, err
+	}
+	throttle.reset(userKey(username))
+	pinThrottle.reset(pinUserKey(userID))
+	_, err = dbPool.Exec(ctx, "UPDATE lockout_events SET unlocked_at=NOW(), unlocked_by=$1 WHERE user_id=$2 AND unlocked_at IS NULL",
+		admin.ID, userID)
+	return true, err
+}
+
+// LockoutEvents lists the lockouts of the admin's households, newest first. Superadmins see all households
+// and the lockouts of unknown usernames.
+func LockoutEvents(ctx context.Context, admin models.AppUser) ([]models.LockoutEvent, error) {
+	scope := HouseholdScope(ctx, admin)
+	condition, household := scope.Where("u.household_id", 1)
+	rows, err := dbPool.Query(ctx, `SELECT e.id, e.user_id, e.username, e.ip_address, e.reason, e.failures, e.locked_until,
+			e.created_at, e.unlocked_at, e.unlocked_by
+		FROM lockout_events e LEFT JOIN users u ON u.id = e.user_id
+		WHERE (e.user_id IS NOT NULL AND `+condition+`) OR (e.user_id IS NULL AND $2)
+		ORDER BY e.created_at DESC LIMIT 500`, household, scope.all)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []models.LockoutEvent{}
+	for rows.Next() {
+		var event models.LockoutEvent
+		if err := rows.Scan(&event.ID, &event.UserID, &event.Username, &event.IPAddress, &event.Reason, &event.Failures,
+			&event.LockedUntil, &event.CreatedAt, &event.UnlockedAt, &event.UnlockedBy); err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
+
+// writeRetryAfter sets the Retry-After header in whole seconds, rounded up.
+func writeRetryAfter(w http.ResponseWriter, wait time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int((wait+time.Second-1)/time.Second)))
+}
@@ -0,0 +1,83 @@
+package middleware
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLoginThrottle(t *testing.T) {
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	const lockout = 10 * time.Minute
+	tests := []struct {
+		name        string
+		maxFailures int
+		// failures of the key, relative to start
+		failures     []time.Duration
+		reset        bool
+		at           time.Duration
+		waitFor      string
+		wantFailures int
+		wantLocked   bool
+		wantWait     time.Duration
+	}{
+		{name: "no failures", maxFailures: 3, at: 0, wantWait: 0},
+		{name: "one failure", maxFailures: 3, failures: []time.Duration{0}, wantFailures: 1, wantWait: time.Second},
+		{name: "delay over", maxFailures: 3, failures: []time.Duration{0}, at: 2 * time.Second, wantFailures: 1, wantWait: 0},
+		{
+			name: "delay doubles", maxFailures: 3, failures: []time.Duration{0, time.Second}, at: time.Second,
+			wantFailures: 2, wantWait: 2 * time.Second,
+		},
+		{
+			name: "delay is capped", maxFailures: 10, failures: []time.Duration{0, 0, 0, 0, 0, 0, 0, 0},
+			wantFailures: 8, wantWait: loginMaxDelay,
+		},
+		{
+			name: "locked out", maxFailures: 3, failures: []time.Duration{0, time.Second, 2 * time.Second}, at: 2 * time.Second,
+			wantFailures: 3, wantLocked: true, wantWait: lockout,
+		},
+		{
+			name: "lockout over", maxFailures: 3, failures: []time.Duration{0, time.Second, 2 * time.Second}, at: 2*time.Second + lockout,
+			wantFailures: 3, wantLocked: true, wantWait: 0,
+		},
+		{
+			name: "old failures are forgotten", maxFailures: 3, failures: []time.Duration{0, time.Second, 2 * lockout}, at: 2 * lockout,
+			wantFailures: 1, wantWait: time.Second,
+		},
+		{name: "reset", maxFailures: 3, failures: []time.Duration{0, time.Second}, reset: true, at: time.Second, wantFailures: 2, wantWait: 0},
+		{name: "other key", maxFailures: 3, failures: []time.Duration{0, time.Second}, at: time.Second, waitFor: "other", wantFailures: 2, wantWait: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			throttle := &loginThrottle{attempts: map[string]*loginAttempts{}, maxFailures: tt.maxFailures, lockout: lockout}
+			var failures int
+			var locked bool
+			for _, at := range tt.failures {
+				failures, locked = throttle.failure(start.Add(at), userKey("anna"))
+			}
+			if failures != tt.wantFailures || locked != tt.wantLocked {
+				t.Errorf("failure() = %d, %v, want %d, %v", failures, locked, tt.wantFailures, tt.wantLocked)
+			}
+			if tt.reset {
+				throttle.reset(userKey("anna"))
+			}
+			key := userKey("anna")
+			if tt.waitFor != "" {
+				key = userKey(tt.waitFor)
+			}
+			if wait := throttle.wait(start.Add(tt.at), key); wait != tt.wantWait {
+				t.Errorf("wait() = %v, want %v", wait, tt.wantWait)
+			}
+		})
+	}
+}
+
+func TestLoginThrottleLongestWait(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	throttle := &loginThrottle{attempts: map[string]*loginAttempts{}, maxFailures: 5, lockout: time.Minute}
+	throttle.failure(now, userKey("anna"))
+	throttle.failure(now, ipKey("192.0.2.1"))
+	throttle.failure(now, ipKey("192.0.2.1"))
+	if wait := throttle.wait(now, userKey("anna"), ipKey("192.0.2.1")); wait != 2*time.Second {
+		t.Errorf("wait() = %v, want the 2s of the IP", wait)
+	}
+}
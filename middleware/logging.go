@@ -0,0 +1,230 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"homeApplications/models"
+
+	"github.com/google/uuid"
+)
+
+const (
+	redacted           = "[REDACTED]"
+	maxRequestIDLength = 128
+)
+
+// sensitiveKeys are log attribute and JSON keys whose values never reach the log, compared in lower case.
+// Keys containing one of sensitiveKeyParts are redacted as well.
+var (
+	sensitiveKeys     = map[string]bool{"pin": true, "sig": true, "codes": true, "authorization": true, "otpauthuri": true}
+	sensitiveKeyParts = []string{"password", "token", "secret"}
+)
+
+type requestInfoKey struct{}
+
+// requestInfo is what the logs know about the request being served. The user is filled in by the authentication.
+type requestInfo struct {
+	id     string
+	userID int
+}
+
+// NewLogger returns a JSON logger that adds the request and user ID of the context to every record
+// and redacts secrets, see sensitiveKeys.
+func NewLogger(w io.Writer, level slog.Leveler) *slog.Logger {
+	handler := slog.NewJSONHandler(w, &slog.HandlerOptions{Level: level, ReplaceAttr: redactAttr})
+	return slog.New(contextHandler{handler})
+}
+
+// ParseLogLevel parses debug, info, warn or error. Anything else is info.
+func ParseLogLevel(value string) slog.Level {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(value)); err != nil {
+		return slog.LevelInfo
+	}
+	return level
+}
+
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, record slog.Record) error {
+	if info, ok := ctx.Value(requestInfoKey{}).(*requestInfo); ok {
+		record.AddAttrs(slog.String("requestId", info.id))
+		if info.userID != 0 {
+			record.AddAttrs(slog.Int("userId", info.userID))
+		}
+	}
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
+
+func isSensitiveKey(key string) bool {
+	key = strings.ToLower(key)
+	if sensitiveKeys[key] {
+		return true
+	}
+	for _, part := range sensitiveKeyParts {
+		if strings.Contains(key, part) {
+			return true
+		}
+	}
+	return false
+}
+
+// redactAttr replaces secrets. Structs and maps are logged as JSON, so they are walked key by key.
+func redactAttr(_ []string, a slog.Attr) slog.Attr {
+	if isSensitiveKey(a.Key) {
+		return slog.String(a.Key, redacted)
+	}
+	if a.Value.Kind() != slog.KindAny {
+		return a
+	}
+	value := a.Value.Any()
+	if _, ok := value.(error); ok {
+		return a
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return a
+	}
+	var decoded any
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return a
+	}
+	return slog.Any(a.Key, redactValue(decoded))
+}
+
+func redactValue(value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		for key, inner := range v {
+			if isSensitiveKey(key) {
+				v[key] = redacted
+			} else {
+				v[key] = redactValue(inner)
+			}
+		}
+	case []any:
+		for i, inner := range v {
+			v[i] = redactValue(inner)
+		}
+	}
+	return value
+}
+
+// RequestLogger assigns every request an ID, or accepts the one the client sent in X-Request-ID, and logs the
+// request with its route, status and latency once it has been served. The same numbers go into the HTTP metrics.
+func RequestLogger(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		info := &requestInfo{id: r.Header.Get(RequestIDHeader)}
+		if !validRequestID(info.id) {
+			info.id = uuid.New().String()
+		}
+		w.Header().Set(RequestIDHeader, info.id)
+		ctx := context.WithValue(r.Context(), requestInfoKey{}, info)
+		r = r.WithContext(ctx)
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+
+		next.ServeHTTP(recorder, r)
+		latency := time.Since(start)
+		observeRequest(r.Method, Route(r), recorder.status, latency)
+
+		level := slog.LevelInfo
+		if recorder.status >= http.StatusInternalServerError {
+			level = slog.LevelError
+		}
+		slog.LogAttrs(ctx, level, "request",
+			slog.String("method", r.Method),
+			slog.String("route", Route(r)),
+			slog.String("path", r.URL.Path),
+			slog.Int("status", recorder.status),
+			slog.Int64("bytes", recorder.bytes),
+			slog.Float64("latencyMs", float64(latency.Microseconds())/1000),
+			slog.String("clientIp", clientIP(r)),
+		)
+	})
+}
+
+// Route returns the pattern of the route that served the request, so paths with IDs are grouped.
+func Route(r *http.Request) string {
+	if r.Pattern == "" {
+		return "unmatched"
+	}
+	return r.Pattern
+}
+
+// validRequestID only accepts short IDs of letters, digits and -_.: so clients cannot inject into logs.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, c := range id {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || strings.ContainsRune("-_.:", c)) {
+			return false
+		}
+	}
+	return true
+}
+
+// RequestID returns the ID of the request being served, or "" outside of RequestLogger.
+func RequestID(ctx context.Context) string {
+	if info, ok := ctx.Value(requestInfoKey{}).(*requestInfo); ok {
+		return info.id
+	}
+	return ""
+}
+
+// setRequestUser records the authenticated user for the logs of the request.
+func setRequestUser(ctx context.Context, user models.AppUser) {
+	if info, ok := ctx.Value(requestInfoKey{}).(*requestInfo); ok {
+		info.userID = user.ID
+	}
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status      int
+	bytes       int64
+	wroteHeader bool
+}
+
+func (w *statusRecorder) WriteHeader(status int) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusRecorder) Write(b []byte) (int, error) {
+	w.wroteHeader = true
+	n, err := w.ResponseWriter.Write(b)
+	w.bytes += int64(n)
+	return n, err
+}
+
+func (w *statusRecorder) Flush() {
+	w.wroteHeader = true
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (w *statusRecorder) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
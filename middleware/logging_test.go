@@ -0,0 +1,126 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"homeApplications/models"
+)
+
+func TestNewLoggerRedacts(t *testing.T) {
+	const secret = "S3cret"
+	user := models.AppUser{ID: 7, Name: "anna", Access: models.Parent, Password: secret, HouseholdID: 2}
+	payload := struct {
+		Name     string `json:"name"`
+		Password string `json:"password"`
+		Device   struct {
+			Token string `json:"deviceToken"`
+		} `json:"device"`
+	}{Name: "anna", Password: secret}
+	payload.Device.Token = secret
+
+	tests := []struct {
+		name  string
+		log   func(logger *slog.Logger)
+		wants []string
+		// omitted is set when the secret is left out rather than redacted, as by AppUser.LogValue
+		omitted bool
+	}{
+		{
+			name:  "add user payload",
+			log:   func(logger *slog.Logger) { logger.Info("Add user", "request", payload) },
+			wants: []string{`"name":"anna"`},
+		},
+		{
+			name: "decoded add user payload",
+			log: func(logger *slog.Logger) {
+				logger.Info("Add user", "request", map[string]any{"name": "anna", "Password": secret})
+			},
+			wants: []string{`"name":"anna"`},
+		},
+		{
+			name:    "user",
+			log:     func(logger *slog.Logger) { logger.Info("Login", "user", user) },
+			wants:   []string{`"user":{"id":7,"name":"anna","access":"parent","householdId":2}`},
+			omitted: true,
+		},
+		{
+			name:    "user pointer",
+			log:     func(logger *slog.Logger) { logger.Info("Login", "user", &user) },
+			wants:   []string{`"name":"anna"`},
+			omitted: true,
+		},
+		{
+			name:  "users in a list",
+			log:   func(logger *slog.Logger) { logger.Info("Users", "users", []models.AppUser{user}) },
+			wants: []string{`"Name":"anna"`},
+		},
+		{
+			name: "nested groups",
+			log: func(logger *slog.Logger) {
+				logger.Info("Change password", slog.Group("request", slog.String("user", "anna"),
+					slog.Group("body", slog.String("oldPassword", secret), slog.String("newPassword", secret))))
+			},
+			wants: []string{`"request":{"user":"anna","body":{"oldPassword":"[REDACTED]"`},
+		},
+		{
+			name: "tokens",
+			log: func(logger *slog.Logger) {
+				logger.Info("Refresh", "refreshToken", secret, "accessToken", secret,
+					"tokens", models.Tokens{AccessToken: secret, RefreshToken: secret})
+			},
+			wants: []string{`"refreshToken":"[REDACTED]"`},
+		},
+		{
+			name: "TOTP",
+			log: func(logger *slog.Logger) {
+				logger.Info("Enroll", "totpSecret", secret, "otpauthUri", secret, "codes", []string{secret})
+			},
+			wants: []string{`"totpSecret":"[REDACTED]"`},
+		},
+		{
+			name: "PIN and authorization",
+			log: func(logger *slog.Logger) {
+				logger.Info("Request", "pin", secret, slog.Group("headers", "Authorization", "Bearer "+secret))
+			},
+			wants: []string{`"headers":{"Authorization":"[REDACTED]"}`},
+		},
+		{
+			name: "logger attributes and groups",
+			log: func(logger *slog.Logger) {
+				logger.With("token", secret).WithGroup("login").Info("Login", "password", secret, "name", "anna")
+			},
+			wants: []string{`"login":{"password":"[REDACTED]","name":"anna"}`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			tt.log(NewLogger(&out, slog.LevelDebug))
+			got := out.String()
+			if strings.Contains(got, secret) {
+				t.Errorf("log shows the secret: %s", got)
+			}
+			if !tt.omitted && !strings.Contains(got, redacted) {
+				t.Errorf("log has nothing redacted: %s", got)
+			}
+			for _, want := range tt.wants {
+				if !strings.Contains(got, want) {
+					t.Errorf("log = %s, want it to contain %s", got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestNewLoggerAddsRequest(t *testing.T) {
+	var out bytes.Buffer
+	ctx := context.WithValue(context.Background(), requestInfoKey{}, &requestInfo{id: "req-1", userID: 7})
+	NewLogger(&out, slog.LevelInfo).InfoContext(ctx, "done")
+	if got := out.String(); !strings.Contains(got, `"requestId":"req-1","userId":7`) {
+		t.Errorf("log = %s, want the request and user ID", got)
+	}
+}
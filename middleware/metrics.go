@@ -0,0 +1,37 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"homeApplications/metrics"
+)
+
+var (
+	httpRequests = metrics.NewCounterVec("homeapp_http_requests_total", "HTTP requests by route and status.",
+		"method", "route", "status")
+	httpDuration = metrics.NewHistogramVec("homeapp_http_request_duration_seconds", "Latency of HTTP requests by route and status.",
+		metrics.DefaultBuckets, "method", "route", "status")
+	// authFailures counts rejected credentials by method: password, totp, pin, token or refresh_token.
+	authFailures = metrics.NewCounterVec("homeapp_auth_failures_total", "Rejected credentials by authentication method.",
+		"method")
+	_ = metrics.NewGaugeFunc("homeapp_db_ready", "1 while the database is reachable, as seen by the DB monitor.", func() float64 {
+		if IsDBReady() {
+			return 1
+		}
+		return 0
+	})
+)
+
+func observeRequest(method, route string, status int, latency time.Duration) {
+	// Clients choose the method, unknown ones are grouped so they cannot create arbitrary many series
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete, http.MethodOptions:
+	default:
+		method = "OTHER"
+	}
+	code := strconv.Itoa(status)
+	httpRequests.Inc(method, route, code)
+	httpDuration.Observe(latency.Seconds(), method, route, code)
+}
@@ -3,12 +3,12 @@ package middleware
 import (
 	"encoding/base64"
 	"errors"
-	"fmt"
 	"homeApplications/models"
-	"log"
+	"log/slog"
 	"net/http"
 	"strings"
 	"sync/atomic"
+	"time"
 
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
@@ -18,26 +18,76 @@ import (
 const ContentTypeJSON = "application/json"
 
 var (
-	dbPool  *pgxpool.Pool
-	dbReady atomic.Bool
+	dbPool      *pgxpool.Pool
+	dbReady     atomic.Bool
+	corsOrigins = map[string]bool{"*": true}
 )
 
 func SetDBConnection(pool *pgxpool.Pool) {
 	dbPool = pool
 }
 
+// JSONMiddleware declares responses as JSON unless the handler set another content type before writing.
 func JSONMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		next.ServeHTTP(w, r)
+		next.ServeHTTP(&jsonWriter{ResponseWriter: w}, r)
+	})
+}
+
+type jsonWriter struct {
+	http.ResponseWriter
+	wroteHeader bool
+}
+
+func (w *jsonWriter) WriteHeader(status int) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
 		if w.Header().Get("Content-Type") == "" {
 			w.Header().Set("Content-Type", ContentTypeJSON)
 		}
-	})
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *jsonWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(b)
 }
 
+func (w *jsonWriter) Flush() {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (w *jsonWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// SetCORSOrigins sets the origins browsers may call the API from, "*" allows every origin.
+func SetCORSOrigins(origins []string) {
+	corsOrigins = map[string]bool{}
+	for _, origin := range origins {
+		corsOrigins[strings.TrimSuffix(origin, "/")] = true
+	}
+}
+
+// CorsMiddleware answers preflight requests. Unless all origins are allowed, the origin of the request
+// is echoed when it is allowed and left out otherwise, so the browser blocks the response.
 func CorsMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		EnableCors(&w)
+		if origin := r.Header.Get("Origin"); !corsOrigins["*"] {
+			w.Header().Add("Vary", "Origin")
+			if corsOrigins[origin] {
+				w.Header().Set("Access-Control-Allow-Origin", origin)
+			}
+		}
 		if r.Method == http.MethodOptions {
 			w.WriteHeader(http.StatusOK)
 			return
@@ -47,9 +97,12 @@ func CorsMiddleware(next http.Handler) http.Handler {
 }
 
 func EnableCors(w *http.ResponseWriter) {
-	(*w).Header().Set("Access-Control-Allow-Origin", "*")
+	if corsOrigins["*"] {
+		(*w).Header().Set("Access-Control-Allow-Origin", "*")
+	}
 	(*w).Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS, PUT, DELETE, PATCH")
-	(*w).Header().Set("Access-Control-Allow-Headers", "Content-Type, Access-Control-Allow-Headers, Authorization, X-Requested-With")
+	(*w).Header().Set("Access-Control-Allow-Headers", "Content-Type, Access-Control-Allow-Headers, Authorization, X-Requested-With, Range, If-Range, X-TOTP-Code, X-Device-Token, X-Request-ID")
+	(*w).Header().Set("Access-Control-Expose-Headers", "Accept-Ranges, Content-Range, Content-Length, ETag, Retry-After, X-Request-ID")
 }
 
 func HashPassword(password string) (string, error) {
@@ -64,7 +117,50 @@ func CheckPassword(hashedPassword, plainPassword string) error {
 	return bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(plainPassword))
 }
 
+// AuthenticateUser accepts either a bearer access token issued by /login or Basic credentials.
+// Users whose role enforces TOTP are rejected until they enrolled, see AuthenticateForEnrollment,
+// and users who have to change their password until they did, see AuthenticateForPasswordChange.
 func AuthenticateUser(r *http.Request) (models.AppUser, error) {
+	user, err := AuthenticateForPasswordChange(r)
+	if err != nil {
+		return user, err
+	}
+	// PIN sessions cannot change the password, so they are not held back by it
+	if user.MustChangePassword && user.AuthMethod != AuthMethodPIN {
+		return models.AppUser{}, ErrPasswordChangeRequired
+	}
+	return user, nil
+}
+
+// AuthenticateForPasswordChange is AuthenticateUser for the password change itself.
+func AuthenticateForPasswordChange(r *http.Request) (models.AppUser, error) {
+	user, err := AuthenticateForEnrollment(r)
+	if err != nil {
+		return user, err
+	}
+	if TOTPRequired(user) {
+		return models.AppUser{}, ErrTOTPEnrollmentRequired
+	}
+	return user, nil
+}
+
+// AuthenticateForEnrollment is AuthenticateUser without the TOTP enforcement, for the endpoints that set TOTP up.
+// Basic credentials are not accepted for users with TOTP enabled, they have to log in and use the bearer token.
+func AuthenticateForEnrollment(r *http.Request) (models.AppUser, error) {
+	authHeader := r.Header.Get("Authorization")
+	if strings.HasPrefix(authHeader, "Bearer ") {
+		return authenticateBearer(r, strings.TrimPrefix(authHeader, "Bearer "))
+	}
+	user, err := AuthenticateBasic(r)
+	if err == nil && user.TOTPEnabled {
+		return models.AppUser{}, ErrSecondFactorRequired
+	}
+	return user, err
+}
+
+// AuthenticateBasic checks Basic credentials against the users table. Failed attempts are throttled per username
+// and client IP, see loginThrottle. All failures look the same to the client apart from TooManyAttemptsError.
+func AuthenticateBasic(r *http.Request) (models.AppUser, error) {
 	authHeader := r.Header.Get("Authorization")
 	errUser := models.AppUser{}
 	if !strings.HasPrefix(authHeader, "Basic ") {
@@ -83,54 +179,72 @@ func AuthenticateUser(r *http.Request) (models.AppUser, error) {
 	}
 
 	username, password := credentials[0], credentials[1]
+	ip := clientIP(r)
+	if wait := throttle.wait(time.Now(), userKey(username), ipKey(ip)); wait > 0 {
+		return errUser, &TooManyAttemptsError{RetryAfter: wait}
+	}
 
 	var user models.AppUser
 	var hashedPassword string
+	var lockedUntil *time.Time
 	// Use the request context so DB calls respect cancellation/timeouts
-	err = dbPool.QueryRow(r.Context(), "SELECT id, name, access_level, password FROM users WHERE name=$1", username).
-		Scan(&user.ID, &user.Name, &user.Access, &hashedPassword)
-	invalidUsernameOrPassword := "invalid username or password"
+	err = dbPool.QueryRow(r.Context(), `SELECT id, name, access_level, household_id, totp_enabled, active, must_change_password, password, locked_until
+		FROM users WHERE name=$1 AND active`, username).
+		Scan(&user.ID, &user.Name, &user.Access, &user.HouseholdID, &user.TOTPEnabled, &user.Active, &user.MustChangePassword, &hashedPassword, &lockedUntil)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
-			return errUser, errors.New(invalidUsernameOrPassword)
+			CheckPassword(dummyHash, password)
+			authFailures.Inc("password")
+			recordLoginFailure(r.Context(), 0, username, ip)
+			return errUser, ErrInvalidCredentials
 		}
-		return errUser, err
+		// A database outage is no wrong password
+		slog.ErrorContext(r.Context(), "Failed to load user", "error", err)
+		return errUser, ErrInternal
+	}
+	// The lockout is persisted so it survives restarts and can be lifted by an admin
+	if lockedUntil != nil && lockedUntil.After(time.Now()) {
+		return errUser, &TooManyAttemptsError{RetryAfter: time.Until(*lockedUntil)}
 	}
 	// Compare the provided password with the hashed password
 	if err := CheckPassword(hashedPassword, password); err != nil {
-		return errUser, errors.New(invalidUsernameOrPassword)
+		authFailures.Inc("password")
+		recordLoginFailure(r.Context(), user.ID, username, ip)
+		return errUser, ErrInvalidCredentials
+	}
+	// With TOTP the login only succeeded once the second factor did, see VerifySecondFactor. Resetting the
+	// failures here would let anyone knowing the password guess codes without ever locking the account.
+	if !user.TOTPEnabled {
+		throttle.reset(userKey(username))
 	}
+	if err := checkClientCertificate(r, user); err != nil {
+		return errUser, err
+	}
+	setRequestUser(r.Context(), user)
 
 	return user, nil
 }
 
-// CheckAuthorization validates the user's authorization and access level.
-func CheckAuthorization(r *http.Request, requiredAccess models.AccessLevel) (*models.AppUser, error) {
+// CheckAuthorization authenticates the user and checks that their role grants the required permission.
+func CheckAuthorization(r *http.Request, permission models.Permission) (*models.AppUser, error) {
 	user, err := AuthenticateUser(r)
 	if err != nil {
-		log.Println("error: " + err.Error() + " in CheckAuthorization")
-		return nil, errors.New("unauthorized")
+		slog.InfoContext(r.Context(), "Request rejected", "error", err)
+		if _, ok := errors.AsType[*TooManyAttemptsError](err); ok || errors.Is(err, ErrTOTPEnrollmentRequired) || errors.Is(err, ErrPasswordChangeRequired) ||
+			errors.Is(err, ErrTokenExpired) || errors.Is(err, ErrClientCertificateRequired) || errors.Is(err, ErrInternal) {
+			return nil, err
+		}
+		return nil, ErrUnauthorized
 	}
 
-	if user.Access != requiredAccess {
-		log.Println(fmt.Sprintf("user '%s' with access level '%s' is not authorized for this action", user.Name, user.Access))
-		return nil, errors.New("forbidden")
+	if !HasPermission(r.Context(), user, permission) {
+		slog.InfoContext(r.Context(), "Permission denied", "user", user, "permission", permission)
+		return nil, ErrForbidden
 	}
 
 	return &user, nil
 }
 
-func HandleError(w http.ResponseWriter, err error) {
-	switch err.Error() {
-	case "unauthorized":
-		http.Error(w, err.Error(), http.StatusUnauthorized)
-	case "forbidden":
-		http.Error(w, err.Error(), http.StatusForbidden)
-	default:
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-	}
-}
-
 // SetDBReady updates the in-memory readiness flag used by health and RequireDB.
 func SetDBReady(v bool) {
 	dbReady.Store(v)
@@ -147,7 +261,7 @@ func RequireDB(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if !IsDBReady() {
 			EnableCors(&w)
-			http.Error(w, "service unavailable", http.StatusServiceUnavailable)
+			WriteError(w, r, ErrServiceUnavailable)
 			return
 		}
 		next.ServeHTTP(w, r)
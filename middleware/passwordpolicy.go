@@ -0,0 +1,239 @@
+package middleware
+
+import (
+	_ "embed"
+	"fmt"
+	"math"
+	"net/http"
+	"strings"
+	"unicode"
+
+	"homeApplications/models"
+)
+
+// Defaults for the password policy, see SetPasswordPolicy.
+const (
+	DefaultPasswordMinLength   = 10
+	DefaultPasswordMinEntropy  = 40.0
+	passwordMaxBytes           = 72 // bcrypt ignores everything after 72 bytes
+	minPatternLength           = 3
+	minKeyboardOrWordLength    = 4
+	yearPatternBits            = 7.0 // about 130 plausible years
+	reversedOrCapitalizedBits  = 1.0
+	keyboardStartingPointsBits = 5.3 // log2 of the 40 keys a keyboard walk can start from
+)
+
+//go:embed common-passwords.txt
+var commonPasswordsFile string
+
+var (
+	commonPasswords   = parseWordList(commonPasswordsFile)
+	maxCommonWordSize = longestWord(commonPasswords)
+	keyboardRows      = []string{"1234567890", "qwertyuiop", "qwertzuiop", "asdfghjkl", "yxcvbnm", "zxcvbnm"}
+	leetReplacer      = strings.NewReplacer("@", "a", "4", "a", "3", "e", "1", "i", "!", "i", "0", "o", "$", "s", "5", "s", "7", "t")
+)
+
+var passwordPolicy = struct {
+	minLength  int
+	minEntropy float64
+}{DefaultPasswordMinLength, DefaultPasswordMinEntropy}
+
+// SetPasswordPolicy configures the minimum length in characters and the minimum estimated entropy in bits.
+// Values <= 0 keep the defaults.
+func SetPasswordPolicy(minLength int, minEntropy float64) {
+	if minLength > 0 {
+		passwordPolicy.minLength = minLength
+	}
+	if minEntropy > 0 {
+		passwordPolicy.minEntropy = minEntropy
+	}
+}
+
+// ValidatePassword checks a new password against the policy and returns every rule it breaks.
+func ValidatePassword(password, userName string) []models.PolicyViolation {
+	var violations []models.PolicyViolation
+	lower := strings.ToLower(password)
+	if length := len([]rune(password)); length < passwordPolicy.minLength {
+		violations = append(violations, models.PolicyViolation{Code: "too_short",
+			Message: fmt.Sprintf("Password must be at least %d characters long", passwordPolicy.minLength)})
+	}
+	if len(password) > passwordMaxBytes {
+		violations = append(violations, models.PolicyViolation{Code: "too_long",
+			Message: fmt.Sprintf("Password must not be longer than %d bytes", passwordMaxBytes)})
+	}
+	if commonPasswords[lower] || commonPasswords[strings.TrimRightFunc(lower, isDigitOrSymbol)] {
+		violations = append(violations, models.PolicyViolation{Code: "common_password",
+			Message: "Password is too common"})
+	}
+	if name := strings.ToLower(strings.TrimSpace(userName)); len(name) >= minPatternLength && strings.Contains(lower, name) {
+		violations = append(violations, models.PolicyViolation{Code: "contains_username",
+			Message: "Password must not contain the user name"})
+	}
+	if bits := EstimateEntropy(password); bits < passwordPolicy.minEntropy {
+		violations = append(violations, models.PolicyViolation{Code: "too_weak",
+			Message: fmt.Sprintf("Password is too easy to guess (%.0f of %.0f bits)", bits, passwordPolicy.minEntropy)})
+	}
+	return violations
+}
+
+// PasswordPolicyError is a 400 with the violated rules as details, so clients can show them next to the input.
+func PasswordPolicyError(violations []models.PolicyViolation) *Error {
+	return NewError(http.StatusBadRequest, "password_policy", "Password does not meet the password policy").
+		WithDetails(map[string][]models.PolicyViolation{"violations": violations})
+}
+
+// EstimateEntropy estimates the bits needed to guess the password in the spirit of zxcvbn: the password is split
+// into the cheapest sequence of patterns (repeats, sequences, keyboard walks, years, common passwords) and
+// single characters, which cost log2 of the character set each.
+func EstimateEntropy(password string) float64 {
+	runes := []rune(strings.ToLower(password))
+	original := []rune(password)
+	charBits := math.Log2(float64(charsetSize(password)))
+
+	// best[i] is the cheapest estimate for the first i characters
+	best := make([]float64, len(runes)+1)
+	for i := 1; i <= len(runes); i++ {
+		best[i] = math.Inf(1)
+	}
+	for i := range runes {
+		relax := func(end int, bits float64) {
+			best[end] = min(best[end], best[i]+bits)
+		}
+		relax(i+1, charBits)
+
+		if n := repeatLength(runes[i:]); n >= minPatternLength {
+			relax(i+n, charBits+math.Log2(float64(n)))
+		}
+		if n := sequenceLength(runes[i:]); n >= minPatternLength {
+			relax(i+n, charBits+math.Log2(float64(n))+reversedOrCapitalizedBits)
+		}
+		if n := keyboardLength(runes[i:]); n >= minKeyboardOrWordLength {
+			relax(i+n, keyboardStartingPointsBits+math.Log2(float64(n)))
+		}
+		if i+4 <= len(runes) && isYear(runes[i:i+4]) {
+			relax(i+4, yearPatternBits)
+		}
+		for end := i + minKeyboardOrWordLength; end <= len(runes) && end-i <= maxCommonWordSize; end++ {
+			word := string(runes[i:end])
+			bits := math.Log2(float64(len(commonPasswords)))
+			if !commonPasswords[word] {
+				if !commonPasswords[leetReplacer.Replace(word)] {
+					continue
+				}
+				bits += reversedOrCapitalizedBits
+			}
+			if strings.ContainsFunc(string(original[i:end]), unicode.IsUpper) {
+				bits += reversedOrCapitalizedBits
+			}
+			relax(end, bits)
+		}
+	}
+	return best[len(runes)]
+}
+
+func charsetSize(password string) int {
+	var lower, upper, digit, symbol, other bool
+	for _, r := range password {
+		switch {
+		case r >= 'a' && r <= 'z':
+			lower = true
+		case r >= 'A' && r <= 'Z':
+			upper = true
+		case r >= '0' && r <= '9':
+			digit = true
+		case r < 128:
+			symbol = true
+		default:
+			other = true
+		}
+	}
+	size := 0
+	for _, class := range []struct {
+		used bool
+		size int
+	}{{lower, 26}, {upper, 26}, {digit, 10}, {symbol, 33}, {other, 100}} {
+		if class.used {
+			size += class.size
+		}
+	}
+	return max(size, 2)
+}
+
+func repeatLength(runes []rune) int {
+	n := 1
+	for n < len(runes) && runes[n] == runes[0] {
+		n++
+	}
+	return n
+}
+
+// sequenceLength returns the length of an ascending or descending run like "abcd" or "4321".
+func sequenceLength(runes []rune) int {
+	if len(runes) < 2 {
+		return len(runes)
+	}
+	delta := runes[1] - runes[0]
+	if delta != 1 && delta != -1 {
+		return 1
+	}
+	n := 2
+	for n < len(runes) && runes[n]-runes[n-1] == delta {
+		n++
+	}
+	return n
+}
+
+// keyboardLength returns the length of a walk along a keyboard row, in either direction.
+func keyboardLength(runes []rune) int {
+	longest := 0
+	for _, row := range keyboardRows {
+		for _, candidate := range []string{row, reverse(row)} {
+			start := strings.IndexRune(candidate, runes[0])
+			if start < 0 {
+				continue
+			}
+			n := 0
+			for n < len(runes) && start+n < len(candidate) && rune(candidate[start+n]) == runes[n] {
+				n++
+			}
+			longest = max(longest, n)
+		}
+	}
+	return longest
+}
+
+func isYear(runes []rune) bool {
+	year := string(runes)
+	return (strings.HasPrefix(year, "19") || strings.HasPrefix(year, "20")) && strings.Trim(year, "0123456789") == ""
+}
+
+func isDigitOrSymbol(r rune) bool {
+	return !unicode.IsLetter(r)
+}
+
+func reverse(s string) string {
+	runes := []rune(s)
+	for i, j := 0, len(runes)-1; i < j; i, j = i+1, j-1 {
+		runes[i], runes[j] = runes[j], runes[i]
+	}
+	return string(runes)
+}
+
+func parseWordList(list string) map[string]bool {
+	words := make(map[string]bool)
+	for line := range strings.Lines(list) {
+		line = strings.TrimSpace(line)
+		if line != "" && !strings.HasPrefix(line, "#") {
+			words[strings.ToLower(line)] = true
+		}
+	}
+	return words
+}
+
+func longestWord(words map[string]bool) int {
+	longest := 0
+	for word := range words {
+		longest = max(longest, len([]rune(word)))
+	}
+	return longest
+}
@@ -0,0 +1,61 @@
+package middleware
+
+import (
+	"math"
+	"slices"
+	"testing"
+)
+
+func TestEstimateEntropy(t *testing.T) {
+	lowerBits := math.Log2(26)
+	tests := []struct {
+		password string
+		min, max float64
+	}{
+		{password: "", min: 0, max: 0},
+		{password: "a", min: lowerBits, max: lowerBits},
+		// a single character repeated: the character and the number of repeats
+		{password: "aaaaaaaaaa", min: lowerBits + math.Log2(10), max: lowerBits + math.Log2(10)},
+		{password: "zyxwvu", min: lowerBits + math.Log2(6) + 1, max: lowerBits + math.Log2(6) + 1},
+		{password: "1990", min: yearPatternBits, max: yearPatternBits},
+		{password: "asdfghjkl", max: 12},
+		{password: "password", max: 10},
+		{password: "P@ssw0rd", max: 10},
+		{password: "password1990", max: 20},
+		{password: "passwordpassword", max: 20},
+		// random characters cost log2 of the character set each
+		{password: "kx7pzm", min: 6 * math.Log2(36), max: 6 * math.Log2(36)},
+		{password: "x7#Kp2!qZm9w", min: DefaultPasswordMinEntropy, max: math.Inf(1)},
+		{password: "Tr0ub4dor&3", min: DefaultPasswordMinEntropy, max: math.Inf(1)},
+		{password: "correct horse battery staple", min: DefaultPasswordMinEntropy, max: math.Inf(1)},
+	}
+	for _, tt := range tests {
+		const tolerance = 1e-9
+		if got := EstimateEntropy(tt.password); got < tt.min-tolerance || got > tt.max+tolerance {
+			t.Errorf("EstimateEntropy(%q) = %.2f, want between %.2f and %.2f", tt.password, got, tt.min, tt.max)
+		}
+	}
+}
+
+func TestValidatePassword(t *testing.T) {
+	tests := []struct {
+		password string
+		userName string
+		want     []string
+	}{
+		{password: "x7#Kp2!qZm9w", userName: "anna"},
+		{password: "x7#Kp2", userName: "anna", want: []string{"too_short", "too_weak"}},
+		{password: "password1990", userName: "anna", want: []string{"common_password", "too_weak"}},
+		{password: "x7#Kp2!annaqZm9w", userName: "Anna", want: []string{"contains_username"}},
+		{password: "x7#Kp2!qZm9w" + string(make([]byte, 64)), userName: "anna", want: []string{"too_long"}},
+	}
+	for _, tt := range tests {
+		var got []string
+		for _, violation := range ValidatePassword(tt.password, tt.userName) {
+			got = append(got, violation.Code)
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("ValidatePassword(%q) = %v, want %v", tt.password, got, tt.want)
+		}
+	}
+}
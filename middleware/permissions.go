@@ -0,0 +1,104 @@
+package middleware
+
+import (
+	"context"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+
+	"homeApplications/models"
+)
+
+// permissionCacheTTL controls how quickly changes to role_permissions take effect.
+const permissionCacheTTL = time.Minute
+
+var (
+	permissionsMu   sync.RWMutex
+	rolePermissions map[models.AccessLevel][]models.Permission
+	permissionsAt   time.Time
+)
+
+// HasPermission reports whether the role of the user grants the permission.
+// Sessions opened with a PIN never get the permissions in pinDeniedPermissions.
+func HasPermission(ctx context.Context, user models.AppUser, permission models.Permission) bool {
+	if user.AuthMethod == AuthMethodPIN && pinDeniedPermissions[permission] {
+		return false
+	}
+	return slices.Contains(PermissionsOf(ctx, user.Access), permission)
+}
+
+// PermissionsOf returns the permissions of a role from a cache that is reloaded from the database once it is stale.
+// When reloading fails the previous permissions are kept.
+func PermissionsOf(ctx context.Context, role models.AccessLevel) []models.Permission {
+	permissionsMu.RLock()
+	permissions, fresh := rolePermissions, time.Since(permissionsAt) < permissionCacheTTL
+	permissionsMu.RUnlock()
+	if !fresh {
+		if loaded, err := loadRolePermissions(ctx); err != nil {
+			slog.ErrorContext(ctx, "Failed to load role permissions", "error", err)
+		} else {
+			permissions = loaded
+		}
+	}
+	return permissions[role]
+}
+
+// Roles returns all roles with their permissions.
+func Roles(ctx context.Context) ([]models.Role, error) {
+	rows, err := dbPool.Query(ctx, "SELECT name, description FROM roles ORDER BY name")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var roles []models.Role
+	for rows.Next() {
+		var role models.Role
+		if err := rows.Scan(&role.Name, &role.Description); err != nil {
+			return nil, err
+		}
+		roles = append(roles, role)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	permissions, err := loadRolePermissions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for i := range roles {
+		roles[i].Permissions = permissions[roles[i].Name]
+		if roles[i].Permissions == nil {
+			roles[i].Permissions = []models.Permission{}
+		}
+	}
+	return roles, nil
+}
+
+func loadRolePermissions(ctx context.Context) (map[models.AccessLevel][]models.Permission, error) {
+	rows, err := dbPool.Query(ctx, "SELECT role, permission FROM role_permissions ORDER BY role, permission")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	loaded := make(map[models.AccessLevel][]models.Permission)
+	for rows.Next() {
+		var role models.AccessLevel
+		var permission models.Permission
+		if err := rows.Scan(&role, &permission); err != nil {
+			return nil, err
+		}
+		loaded[role] = append(loaded[role], permission)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	permissionsMu.Lock()
+	rolePermissions, permissionsAt = loaded, time.Now()
+	permissionsMu.Unlock()
+	return loaded, nil
+}
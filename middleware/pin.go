@@ -0,0 +1,133 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"homeApplications/models"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Authentication methods stored with a session.
+const (
+	AuthMethodPassword = "password"
+	AuthMethodPIN      = "pin"
+)
+
+// PINs only have 10^4 to 10^6 combinations, so they are throttled much harder than passwords.
+var pinThrottle = &loginThrottle{
+	attempts:    make(map[string]*loginAttempts),
+	maxFailures: 3,
+	lockout:     30 * time.Minute,
+}
+
+// pinDeniedPermissions are never granted to a session that was opened with a PIN, whatever the role allows.
+var pinDeniedPermissions = map[models.Permission]bool{
+	models.PermChangePassword:       true,
+	models.PermUsersManage:          true,
+	models.PermHouseholdsManage:     true,
+	models.PermPocketMoneyCreate:    true,
+	models.PermPocketMoneySchedules: true,
+	models.PermMusicManage:          true,
+	models.PermPlaylistsCurate:      true,
+}
+
+// ValidatePIN checks that a PIN has 4 to 6 digits and is not a trivial one like 0000 or 1234.
+func ValidatePIN(pin string) error {
+	if len(pin) < 4 || len(pin) > 6 || strings.Trim(pin, "0123456789") != "" {
+		return NewError(http.StatusBadRequest, "invalid_pin_format", "PIN must have 4 to 6 digits")
+	}
+	runes := []rune(pin)
+	if repeatLength(runes) == len(runes) || sequenceLength(runes) == len(runes) {
+		return NewError(http.StatusBadRequest, "pin_too_weak", "PIN is too easy to guess")
+	}
+	return nil
+}
+
+// SetPIN stores the hashed PIN of a child, an empty PIN removes it.
+func SetPIN(ctx context.Context, userID int, pin string) error {
+	if pin == "" {
+		_, err := dbPool.Exec(ctx, "UPDATE users SET pin_hash=NULL, pin_locked_until=NULL WHERE id=$1", userID)
+		return err
+	}
+	hashedPIN, err := HashPassword(pin)
+	if err != nil {
+		return err
+	}
+	_, err = dbPool.Exec(ctx, "UPDATE users SET pin_hash=$1, pin_locked_until=NULL WHERE id=$2", hashedPIN, userID)
+	if err == nil {
+		pinThrottle.reset(pinUserKey(userID))
+	}
+	return err
+}
+
+func pinUserKey(userID int) string        { return "user:" + strconv.Itoa(userID) }
+func pinDeviceKey(deviceID string) string { return "device:" + deviceID }
+
+// AuthenticatePIN logs a child in with their PIN. It is only accepted from a registered device of the child's household.
+// Failures are counted per user and per device; after three the PIN of the user is locked.
+func AuthenticatePIN(r *http.Request, userID int, pin string) (models.AppUser, error) {
+	errUser := models.AppUser{}
+	ctx := r.Context()
+	device, err := deviceFromRequest(ctx, r)
+	if err != nil {
+		return errUser, err
+	}
+	if wait := pinThrottle.wait(time.Now(), pinUserKey(userID), pinDeviceKey(device.id)); wait > 0 {
+		return errUser, &TooManyAttemptsError{RetryAfter: wait}
+	}
+
+	var user models.AppUser
+	var hashedPIN *string
+	var lockedUntil *time.Time
+	err = dbPool.QueryRow(ctx, `SELECT id, name, access_level, household_id, totp_enabled, active, must_change_password, pin_hash, pin_locked_until
+		FROM users WHERE id=$1 AND active`, userID).
+		Scan(&user.ID, &user.Name, &user.Access, &user.HouseholdID, &user.TOTPEnabled, &user.Active, &user.MustChangePassword, &hashedPIN, &lockedUntil)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		slog.ErrorContext(r.Context(), "Failed to load user", "error", err)
+		return errUser, ErrInternal
+	}
+	if err != nil || hashedPIN == nil || user.Access != models.Child || user.HouseholdID != device.householdID {
+		authFailures.Inc("pin")
+		pinThrottle.failure(time.Now(), pinDeviceKey(device.id))
+		return errUser, ErrInvalidPIN
+	}
+	if lockedUntil != nil && lockedUntil.After(time.Now()) {
+		return errUser, &TooManyAttemptsError{RetryAfter: time.Until(*lockedUntil)}
+	}
+	if err := CheckPassword(*hashedPIN, pin); err != nil {
+		authFailures.Inc("pin")
+		recordPINFailure(ctx, user, device.id, clientIP(r))
+		return errUser, ErrInvalidPIN
+	}
+	pinThrottle.reset(pinUserKey(user.ID))
+	user.AuthMethod = AuthMethodPIN
+	user.DeviceID = device.id
+	touchDevice(ctx, device.id, clientIP(r))
+	if err := checkClientCertificate(r, user); err != nil {
+		return errUser, err
+	}
+	setRequestUser(ctx, user)
+	return user, nil
+}
+
+func recordPINFailure(ctx context.Context, user models.AppUser, deviceID, ip string) {
+	now := time.Now()
+	pinThrottle.failure(now, pinDeviceKey(deviceID))
+	failures, locked := pinThrottle.failure(now, pinUserKey(user.ID))
+	if !locked {
+		return
+	}
+	until := now.Add(pinThrottle.lockout)
+	slog.WarnContext(ctx, "PIN login locked", "user", user, "until", until, "failures", failures)
+	if _, err := dbPool.Exec(ctx, "UPDATE users SET pin_locked_until=$1 WHERE id=$2", until, user.ID); err != nil {
+		slog.ErrorContext(ctx, "Failed to lock PIN", "error", err)
+	}
+	saveLockoutEvent(ctx, user.ID, user.Name, ip, "pin", failures, until)
+}
@@ -0,0 +1,121 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"homeApplications/models"
+)
+
+func TestValidatePIN(t *testing.T) {
+	tests := []struct {
+		pin      string
+		wantCode string
+	}{
+		{pin: "1357"},
+		{pin: "2580"},
+		{pin: "1233"},
+		{pin: "90210"},
+		{pin: "973164"},
+		{pin: "", wantCode: "invalid_pin_format"},
+		{pin: "135", wantCode: "invalid_pin_format"},
+		{pin: "1357913", wantCode: "invalid_pin_format"},
+		{pin: "13a7", wantCode: "invalid_pin_format"},
+		{pin: " 1357", wantCode: "invalid_pin_format"},
+		{pin: "-135", wantCode: "invalid_pin_format"},
+		{pin: "١٣٥٧", wantCode: "invalid_pin_format"}, // Arabic-Indic digits
+		{pin: "0000", wantCode: "pin_too_weak"},
+		{pin: "111111", wantCode: "pin_too_weak"},
+		{pin: "1234", wantCode: "pin_too_weak"},
+		{pin: "987654", wantCode: "pin_too_weak"},
+	}
+	for _, tt := range tests {
+		err := ValidatePIN(tt.pin)
+		if tt.wantCode == "" {
+			if err != nil {
+				t.Errorf("ValidatePIN(%q) error = %v, want nil", tt.pin, err)
+			}
+			continue
+		}
+		if apiErr, ok := errors.AsType[*Error](err); !ok || apiErr.Code != tt.wantCode {
+			t.Errorf("ValidatePIN(%q) error = %v, want %s", tt.pin, err, tt.wantCode)
+		}
+	}
+}
+
+func TestPINThrottle(t *testing.T) {
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name string
+		// failures of the key, relative to start
+		failures     []time.Duration
+		at           time.Duration
+		wantFailures int
+		wantLocked   bool
+		wantWait     time.Duration
+	}{
+		{name: "one failure", failures: []time.Duration{0}, wantFailures: 1, wantWait: time.Second},
+		{name: "two failures", failures: []time.Duration{0, time.Second}, at: time.Second, wantFailures: 2, wantWait: 2 * time.Second},
+		{
+			name: "third failure locks", failures: []time.Duration{0, time.Second, 3 * time.Second}, at: 3 * time.Second,
+			wantFailures: 3, wantLocked: true, wantWait: 30 * time.Minute,
+		},
+		{
+			name: "still locked", failures: []time.Duration{0, time.Second, 3 * time.Second}, at: 3*time.Second + 29*time.Minute,
+			wantFailures: 3, wantLocked: true, wantWait: time.Minute,
+		},
+		{
+			name: "lock over", failures: []time.Duration{0, time.Second, 3 * time.Second}, at: 3*time.Second + 30*time.Minute,
+			wantFailures: 3, wantLocked: true, wantWait: 0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			throttle := &loginThrottle{attempts: map[string]*loginAttempts{}, maxFailures: pinThrottle.maxFailures, lockout: pinThrottle.lockout}
+			var failures int
+			var locked bool
+			for _, at := range tt.failures {
+				failures, locked = throttle.failure(start.Add(at), pinUserKey(7))
+			}
+			if failures != tt.wantFailures || locked != tt.wantLocked {
+				t.Errorf("failure() = %d, %v, want %d, %v", failures, locked, tt.wantFailures, tt.wantLocked)
+			}
+			if wait := throttle.wait(start.Add(tt.at), pinUserKey(7)); wait != tt.wantWait {
+				t.Errorf("wait() = %v, want %v", wait, tt.wantWait)
+			}
+			if wait := throttle.wait(start.Add(tt.at), pinUserKey(8), pinDeviceKey("other")); wait != 0 {
+				t.Errorf("wait() of another child = %v, want 0", wait)
+			}
+		})
+	}
+}
+
+func TestRecordPINFailure(t *testing.T) {
+	unreachableDB(t)
+	previous := pinThrottle
+	pinThrottle = &loginThrottle{attempts: map[string]*loginAttempts{}, maxFailures: previous.maxFailures, lockout: previous.lockout}
+	t.Cleanup(func() { pinThrottle = previous })
+
+	child := models.AppUser{ID: 7, Name: "ben", Access: models.Child}
+	for range 3 {
+		recordPINFailure(context.Background(), child, "tablet", "192.0.2.1")
+	}
+	// Both the child and the device are locked, so guessing goes on neither from another device nor for a sibling
+	now := time.Now()
+	if wait := pinThrottle.wait(now, pinUserKey(child.ID)); wait < 29*time.Minute {
+		t.Errorf("child wait = %v, want the 30 minute lock", wait)
+	}
+	if wait := pinThrottle.wait(now, pinDeviceKey("tablet")); wait < 29*time.Minute {
+		t.Errorf("device wait = %v, want the 30 minute lock", wait)
+	}
+	// A successful login or a new PIN lifts the lock of the child, not that of the device
+	pinThrottle.reset(pinUserKey(child.ID))
+	if wait := pinThrottle.wait(now, pinUserKey(child.ID)); wait != 0 {
+		t.Errorf("child wait after reset = %v, want 0", wait)
+	}
+	if wait := pinThrottle.wait(now, pinDeviceKey("tablet")); wait < 29*time.Minute {
+		t.Errorf("device wait after reset = %v, want the lock", wait)
+	}
+}
@@ -0,0 +1,78 @@
+package middleware
+
+import (
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"homeApplications/models"
+)
+
+var (
+	hstsHeader       string
+	clientCertLevels = map[models.AccessLevel]bool{}
+)
+
+// SetHSTS sets how long browsers only use HTTPS after they were served over it. Zero disables the header.
+func SetHSTS(maxAge time.Duration) {
+	hstsHeader = ""
+	if maxAge > 0 {
+		hstsHeader = "max-age=" + strconv.Itoa(int(maxAge.Seconds()))
+	}
+}
+
+// HSTSMiddleware adds Strict-Transport-Security to responses sent over TLS.
+func HSTSMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS != nil && hstsHeader != "" {
+			w.Header().Set("Strict-Transport-Security", hstsHeader)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RedirectToHTTPS returns the handler of the plain HTTP listener, it sends every request to the same URL
+// on the HTTPS address.
+func RedirectToHTTPS(httpsAddr string) http.Handler {
+	_, port, _ := net.SplitHostPort(httpsAddr)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if strings.Contains(host, ":") {
+			host = "[" + host + "]"
+		}
+		if port != "" && port != "443" {
+			host += ":" + port
+		}
+		status := http.StatusPermanentRedirect
+		// Old clients turn a POST into a GET on 301, 308 keeps the method
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			status = http.StatusMovedPermanently
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), status)
+	})
+}
+
+// SetClientCertEnforcement sets the access levels that have to present a client certificate signed by the
+// CA the TLS server was configured with.
+func SetClientCertEnforcement(levels []string) {
+	clientCertLevels = map[models.AccessLevel]bool{}
+	for _, level := range levels {
+		if level = strings.TrimSpace(level); level != "" {
+			clientCertLevels[models.AccessLevel(level).Normalize()] = true
+		}
+	}
+}
+
+// checkClientCertificate rejects users of the enforced access levels unless the TLS server verified a client
+// certificate, which only happens when a client CA is configured.
+func checkClientCertificate(r *http.Request, user models.AppUser) error {
+	if !clientCertLevels[user.Access] || r.TLS != nil && len(r.TLS.VerifiedChains) > 0 {
+		return nil
+	}
+	return ErrClientCertificateRequired
+}
@@ -0,0 +1,225 @@
+package middleware
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"homeApplications/models"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	AccessTokenTTL  = 15 * time.Minute
+	RefreshTokenTTL = 30 * 24 * time.Hour
+)
+
+var tokenSecret []byte
+
+type accessClaims struct {
+	SessionID string `json:"sid"`
+	UserID    int    `json:"uid"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+// SetTokenSecret sets the key used to sign access tokens. Without a secret a random one is generated,
+// which means all issued tokens become invalid when the server restarts.
+func SetTokenSecret(secret string) error {
+	if secret != "" {
+		tokenSecret = []byte(secret)
+		return nil
+	}
+	tokenSecret = make([]byte, 32)
+	if _, err := rand.Read(tokenSecret); err != nil {
+		return fmt.Errorf("generate token secret: %w", err)
+	}
+	slog.Warn("TOKEN_SECRET is not set, using a random secret. Sessions will not survive a restart.")
+	return nil
+}
+
+// Sign returns the HMAC-SHA256 of data using the token secret.
+func Sign(data []byte) []byte {
+	mac := hmac.New(sha256.New, tokenSecret)
+	mac.Write(data)
+	return mac.Sum(nil)
+}
+
+// IssueSession creates a new server-side session for the user and returns its tokens.
+// The auth method of the user (password if empty) and its device are kept with the session.
+func IssueSession(ctx context.Context, user models.AppUser) (models.Tokens, error) {
+	authMethod := user.AuthMethod
+	if authMethod == "" {
+		authMethod = AuthMethodPassword
+	}
+	var deviceID *string
+	if user.DeviceID != "" {
+		deviceID = &user.DeviceID
+	}
+	refreshToken, err := randomToken()
+	if err != nil {
+		return models.Tokens{}, err
+	}
+	sessionID := uuid.New().String()
+	_, err = dbPool.Exec(ctx, `INSERT INTO sessions (id, user_id, refresh_token_hash, expires_at, auth_method, device_id)
+		VALUES ($1, $2, $3, $4, $5, $6)`,
+		sessionID, user.ID, hashToken(refreshToken), time.Now().Add(RefreshTokenTTL), authMethod, deviceID)
+	if err != nil {
+		return models.Tokens{}, err
+	}
+	return newTokens(sessionID, user.ID, refreshToken)
+}
+
+// RefreshSession exchanges a refresh token for a new token pair. The refresh token is rotated,
+// so every refresh token can only be used once. Like authenticateBearer it requires an active user and,
+// for sessions bound to a device, the token of that device, which must not be revoked.
+func RefreshSession(r *http.Request, refreshToken string) (models.Tokens, error) {
+	ctx := r.Context()
+	newRefreshToken, err := randomToken()
+	if err != nil {
+		return models.Tokens{}, err
+	}
+	var sessionID string
+	var userID int
+	err = dbPool.QueryRow(ctx, `UPDATE sessions s SET refresh_token_hash=$1
+		FROM users u
+		WHERE s.refresh_token_hash=$2 AND s.revoked_at IS NULL AND s.expires_at > NOW() AND u.id = s.user_id AND u.active
+			AND (s.device_id IS NULL OR EXISTS (SELECT 1 FROM devices d WHERE d.id = s.device_id AND d.revoked_at IS NULL AND d.token_hash = $3))
+		RETURNING s.id, s.user_id`, hashToken(newRefreshToken), hashToken(refreshToken), hashToken(r.Header.Get(DeviceTokenHeader))).
+		Scan(&sessionID, &userID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			authFailures.Inc("refresh_token")
+			return models.Tokens{}, ErrUnauthorized
+		}
+		slog.ErrorContext(ctx, "Failed to refresh session", "error", err)
+		return models.Tokens{}, ErrInternal
+	}
+	return newTokens(sessionID, userID, newRefreshToken)
+}
+
+// RevokeSession marks a single session as revoked.
+func RevokeSession(ctx context.Context, sessionID string) error {
+	_, err := dbPool.Exec(ctx, "UPDATE sessions SET revoked_at = NOW() WHERE id=$1 AND revoked_at IS NULL", sessionID)
+	return err
+}
+
+// RevokeUserSessions revokes all sessions of a user except the one given (may be empty).
+func RevokeUserSessions(ctx context.Context, userID int, exceptSessionID string) error {
+	var err error
+	if exceptSessionID == "" {
+		_, err = dbPool.Exec(ctx, "UPDATE sessions SET revoked_at = NOW() WHERE user_id=$1 AND revoked_at IS NULL", userID)
+	} else {
+		_, err = dbPool.Exec(ctx, "UPDATE sessions SET revoked_at = NOW() WHERE user_id=$1 AND id<>$2 AND revoked_at IS NULL", userID, exceptSessionID)
+	}
+	return err
+}
+
+// authenticateBearer checks the access token and its session. Sessions bound to a device are only accepted
+// together with the token of that device, and end when the device is revoked.
+func authenticateBearer(r *http.Request, token string) (models.AppUser, error) {
+	ctx := r.Context()
+	errUser := models.AppUser{}
+	claims, err := parseAccessToken(token)
+	if err != nil {
+		slog.InfoContext(r.Context(), "Request rejected", "error", err)
+		authFailures.Inc("token")
+		if errors.Is(err, ErrTokenExpired) {
+			return errUser, err
+		}
+		return errUser, ErrUnauthorized
+	}
+
+	var user models.AppUser
+	var deviceID, deviceTokenHash *string
+	err = dbPool.QueryRow(ctx, `SELECT u.id, u.name, u.access_level, u.household_id, u.totp_enabled, u.active, u.must_change_password,
+			s.auth_method, s.device_id, d.token_hash
+		FROM sessions s JOIN users u ON u.id = s.user_id LEFT JOIN devices d ON d.id = s.device_id AND d.revoked_at IS NULL
+		WHERE s.id=$1 AND s.user_id=$2 AND s.revoked_at IS NULL AND s.expires_at > NOW() AND u.active`, claims.SessionID, claims.UserID).
+		Scan(&user.ID, &user.Name, &user.Access, &user.HouseholdID, &user.TOTPEnabled, &user.Active, &user.MustChangePassword,
+			&user.AuthMethod, &deviceID, &deviceTokenHash)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			authFailures.Inc("token")
+			return errUser, ErrUnauthorized
+		}
+		slog.ErrorContext(ctx, "Failed to load session", "error", err)
+		return errUser, ErrInternal
+	}
+	if deviceID != nil {
+		if deviceTokenHash == nil || !hmac.Equal([]byte(*deviceTokenHash), []byte(hashToken(r.Header.Get(DeviceTokenHeader)))) {
+			slog.WarnContext(ctx, "Session used without the token of its device", "sessionId", claims.SessionID)
+			authFailures.Inc("token")
+			return errUser, ErrUnauthorized
+		}
+		user.DeviceID = *deviceID
+		touchDevice(ctx, user.DeviceID, clientIP(r))
+	}
+	user.SessionID = claims.SessionID
+	if err := checkClientCertificate(r, user); err != nil {
+		return errUser, err
+	}
+	setRequestUser(ctx, user)
+	return user, nil
+}
+
+func newTokens(sessionID string, userID int, refreshToken string) (models.Tokens, error) {
+	expiresAt := time.Now().Add(AccessTokenTTL)
+	payload, err := json.Marshal(accessClaims{SessionID: sessionID, UserID: userID, ExpiresAt: expiresAt.Unix()})
+	if err != nil {
+		return models.Tokens{}, err
+	}
+	encodedPayload := base64.RawURLEncoding.EncodeToString(payload)
+	signature := base64.RawURLEncoding.EncodeToString(Sign([]byte(encodedPayload)))
+	return models.Tokens{
+		AccessToken:  encodedPayload + "." + signature,
+		RefreshToken: refreshToken,
+		ExpiresAt:    expiresAt,
+	}, nil
+}
+
+func parseAccessToken(token string) (accessClaims, error) {
+	var claims accessClaims
+	encodedPayload, encodedSignature, ok := strings.Cut(token, ".")
+	if !ok {
+		return claims, errors.New("malformed token")
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(encodedSignature)
+	if err != nil || !hmac.Equal(signature, Sign([]byte(encodedPayload))) {
+		return claims, errors.New("invalid token signature")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encodedPayload)
+	if err != nil {
+		return claims, errors.New("malformed token")
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return claims, errors.New("malformed token")
+	}
+	if time.Now().Unix() >= claims.ExpiresAt {
+		return claims, ErrTokenExpired
+	}
+	return claims, nil
+}
+
+func randomToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,244 @@
+package middleware
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"homeApplications/models"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// RFC 6238 parameters, these are the defaults every authenticator app understands.
+const (
+	totpIssuer        = "homeApplications"
+	totpPeriod        = 30
+	totpDigits        = 6
+	totpSkew          = 1
+	recoveryCodeCount = 10
+)
+
+// TOTPHeader carries the TOTP or recovery code on /login.
+const TOTPHeader = "X-TOTP-Code"
+
+var (
+	totpEnforced = map[models.AccessLevel]bool{}
+	base32NoPad  = base32.StdEncoding.WithPadding(base32.NoPadding)
+)
+
+// SetTOTPEnforcement sets the access levels that have to use a second factor.
+func SetTOTPEnforcement(levels []string) {
+	totpEnforced = map[models.AccessLevel]bool{}
+	for _, level := range levels {
+		if level = strings.TrimSpace(level); level != "" {
+			totpEnforced[models.AccessLevel(level).Normalize()] = true
+		}
+	}
+}
+
+// TOTPRequired reports whether the user has to enroll a second factor before using the API.
+func TOTPRequired(user models.AppUser) bool {
+	return totpEnforced[user.Access] && !user.TOTPEnabled
+}
+
+// VerifySecondFactor checks the TOTP or recovery code sent with a login of a user with TOTP enabled.
+// Wrong codes count as failed logins, a correct one resets the failures of the username.
+func VerifySecondFactor(r *http.Request, user models.AppUser) error {
+	code := r.Header.Get(TOTPHeader)
+	if code == "" {
+		return ErrTOTPRequired
+	}
+	if err := guardSecondFactor(r, user, func() (bool, error) { return checkSecondFactor(r.Context(), user.ID, code) }); err != nil {
+		return err
+	}
+	throttle.reset(userKey(user.Name))
+	return nil
+}
+
+// ConfirmSecondFactor checks the code a logged in user sends to confirm a TOTP management action.
+// It is throttled like a login, so a stolen access token does not allow guessing the second factor.
+func ConfirmSecondFactor(r *http.Request, user models.AppUser, code string) error {
+	return guardSecondFactor(r, user, func() (bool, error) { return checkSecondFactor(r.Context(), user.ID, code) })
+}
+
+// guardSecondFactor runs check under the login throttle of the username and the client IP. While they have to wait
+// the code is not checked at all, a wrong code counts as a failed login and can lock the account.
+func guardSecondFactor(r *http.Request, user models.AppUser, check func() (bool, error)) error {
+	ip := clientIP(r)
+	if wait := throttle.wait(time.Now(), userKey(user.Name), ipKey(ip)); wait > 0 {
+		return &TooManyAttemptsError{RetryAfter: wait}
+	}
+	ok, err := check()
+	if err != nil {
+		return err
+	}
+	if !ok {
+		authFailures.Inc("totp")
+		recordLoginFailure(r.Context(), user.ID, user.Name, ip)
+		return ErrInvalidSecondFactor
+	}
+	return nil
+}
+
+// EnrollTOTP creates a new secret for the user. It only becomes active once ConfirmTOTP verified the first code.
+func EnrollTOTP(ctx context.Context, user models.AppUser) (models.TOTPEnrollment, error) {
+	key := make([]byte, 20)
+	if _, err := rand.Read(key); err != nil {
+		return models.TOTPEnrollment{}, err
+	}
+	secret := base32NoPad.EncodeToString(key)
+	tag, err := dbPool.Exec(ctx, "UPDATE users SET totp_secret=$1, totp_last_step=NULL WHERE id=$2 AND NOT totp_enabled", secret, user.ID)
+	if err != nil {
+		return models.TOTPEnrollment{}, err
+	}
+	if tag.RowsAffected() == 0 {
+		return models.TOTPEnrollment{}, ErrTOTPAlreadyEnabled
+	}
+
+	label := url.PathEscape(totpIssuer + ":" + user.Name)
+	query := url.Values{
+		"secret":    {secret},
+		"issuer":    {totpIssuer},
+		"algorithm": {"SHA1"},
+		"digits":    {fmt.Sprint(totpDigits)},
+		"period":    {fmt.Sprint(totpPeriod)},
+	}
+	return models.TOTPEnrollment{Secret: secret, OTPAuthURI: "otpauth://totp/" + label + "?" + query.Encode()}, nil
+}
+
+// ConfirmTOTP enables TOTP when the code matches the enrolled secret and returns fresh recovery codes.
+func ConfirmTOTP(r *http.Request, user models.AppUser, code string) (models.RecoveryCodes, error) {
+	ctx := r.Context()
+	var secret *string
+	var enabled bool
+	if err := dbPool.QueryRow(ctx, "SELECT totp_secret, totp_enabled FROM users WHERE id=$1", user.ID).Scan(&secret, &enabled); err != nil {
+		return models.RecoveryCodes{}, err
+	}
+	if enabled {
+		return models.RecoveryCodes{}, ErrTOTPAlreadyEnabled
+	}
+	if secret == nil {
+		return models.RecoveryCodes{}, ErrTOTPNotEnrolled
+	}
+	var step int64
+	err := guardSecondFactor(r, user, func() (bool, error) {
+		var ok bool
+		step, ok = matchTOTP(*secret, code, time.Now())
+		return ok, nil
+	})
+	if err != nil {
+		return models.RecoveryCodes{}, err
+	}
+	if _, err := dbPool.Exec(ctx, "UPDATE users SET totp_enabled=TRUE, totp_last_step=$1 WHERE id=$2", step, user.ID); err != nil {
+		return models.RecoveryCodes{}, err
+	}
+	return RegenerateRecoveryCodes(ctx, user)
+}
+
+// DisableTOTP turns the second factor off after checking a current code. Users of an enforcing role cannot disable it.
+func DisableTOTP(r *http.Request, user models.AppUser, code string) error {
+	if totpEnforced[user.Access] {
+		return ErrTOTPEnforced
+	}
+	if err := ConfirmSecondFactor(r, user, code); err != nil {
+		return err
+	}
+	ctx := r.Context()
+	if _, err := dbPool.Exec(ctx, "UPDATE users SET totp_enabled=FALSE, totp_secret=NULL, totp_last_step=NULL WHERE id=$1", user.ID); err != nil {
+		return err
+	}
+	_, err := dbPool.Exec(ctx, "DELETE FROM recovery_codes WHERE user_id=$1", user.ID)
+	return err
+}
+
+// RegenerateRecoveryCodes replaces all recovery codes of the user. Only their hashes are stored.
+func RegenerateRecoveryCodes(ctx context.Context, user models.AppUser) (models.RecoveryCodes, error) {
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		raw := make([]byte, 7)
+		if _, err := rand.Read(raw); err != nil {
+			return models.RecoveryCodes{}, err
+		}
+		code := strings.ToLower(base32NoPad.EncodeToString(raw))[:10]
+		codes[i] = code[:5] + "-" + code[5:]
+		hashes[i] = hashToken(code)
+	}
+
+	tx, err := dbPool.Begin(ctx)
+	if err != nil {
+		return models.RecoveryCodes{}, err
+	}
+	defer tx.Rollback(ctx)
+	if _, err := tx.Exec(ctx, "DELETE FROM recovery_codes WHERE user_id=$1", user.ID); err != nil {
+		return models.RecoveryCodes{}, err
+	}
+	if _, err := tx.Exec(ctx, "INSERT INTO recovery_codes (user_id, code_hash) SELECT $1, UNNEST($2::text[])", user.ID, hashes); err != nil {
+		return models.RecoveryCodes{}, err
+	}
+	return models.RecoveryCodes{Codes: codes}, tx.Commit(ctx)
+}
+
+// checkSecondFactor accepts either a TOTP code or an unused recovery code. A TOTP code is accepted only once,
+// so an observed code cannot be replayed within its validity window.
+func checkSecondFactor(ctx context.Context, userID int, code string) (bool, error) {
+	code = strings.TrimSpace(code)
+	if len(code) == totpDigits {
+		var secret *string
+		err := dbPool.QueryRow(ctx, "SELECT totp_secret FROM users WHERE id=$1 AND totp_enabled", userID).Scan(&secret)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return false, nil
+		}
+		if err != nil || secret == nil {
+			return false, err
+		}
+		step, ok := matchTOTP(*secret, code, time.Now())
+		if !ok {
+			return false, nil
+		}
+		tag, err := dbPool.Exec(ctx, "UPDATE users SET totp_last_step=$1 WHERE id=$2 AND (totp_last_step IS NULL OR totp_last_step < $1)", step, userID)
+		return err == nil && tag.RowsAffected() == 1, err
+	}
+
+	normalized := strings.ToLower(strings.ReplaceAll(code, "-", ""))
+	tag, err := dbPool.Exec(ctx, "UPDATE recovery_codes SET used_at=NOW() WHERE user_id=$1 AND code_hash=$2 AND used_at IS NULL",
+		userID, hashToken(normalized))
+	return err == nil && tag.RowsAffected() == 1, err
+}
+
+// matchTOTP returns the time step the code belongs to, allowing totpSkew steps of clock drift.
+func matchTOTP(secret, code string, now time.Time) (int64, bool) {
+	key, err := base32NoPad.DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return 0, false
+	}
+	current := now.Unix() / totpPeriod
+	for step := current - totpSkew; step <= current+totpSkew; step++ {
+		if hmac.Equal([]byte(totpCode(key, step)), []byte(code)) {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// totpCode computes the HOTP value (RFC 4226) for the counter step.
+func totpCode(key []byte, step int64) string {
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], uint64(step))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(counter[:])
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", totpDigits, value%1_000_000)
+}
@@ -0,0 +1,152 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"homeApplications/models"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// rfc6238Key is the SHA1 key of the RFC 6238 test vectors.
+var rfc6238Key = []byte("12345678901234567890")
+
+func TestTOTPCode(t *testing.T) {
+	// RFC 6238 appendix B lists 8 digit codes, the server uses their last 6 digits
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{unix: 59, want: "287082"},
+		{unix: 1111111109, want: "081804"},
+		{unix: 1111111111, want: "050471"},
+		{unix: 1234567890, want: "005924"},
+		{unix: 2000000000, want: "279037"},
+		{unix: 20000000000, want: "353130"},
+	}
+	for _, tt := range tests {
+		if got := totpCode(rfc6238Key, tt.unix/totpPeriod); got != tt.want {
+			t.Errorf("totpCode(%d) = %s, want %s", tt.unix, got, tt.want)
+		}
+	}
+}
+
+func TestMatchTOTP(t *testing.T) {
+	secret := base32NoPad.EncodeToString(rfc6238Key)
+	now := time.Unix(1111111111, 0)
+	step := now.Unix() / totpPeriod
+	tests := []struct {
+		name     string
+		secret   string
+		code     string
+		wantStep int64
+		wantOK   bool
+	}{
+		{name: "current step", secret: secret, code: "050471", wantStep: step, wantOK: true},
+		{name: "lower case secret", secret: "gezdgnbvgy3tqojqgezdgnbvgy3tqojq", code: "050471", wantStep: step, wantOK: true},
+		{name: "previous step", secret: secret, code: totpCode(rfc6238Key, step-1), wantStep: step - 1, wantOK: true},
+		{name: "next step", secret: secret, code: totpCode(rfc6238Key, step+1), wantStep: step + 1, wantOK: true},
+		{name: "two steps ago", secret: secret, code: totpCode(rfc6238Key, step-2)},
+		{name: "two steps ahead", secret: secret, code: totpCode(rfc6238Key, step+2)},
+		{name: "wrong code", secret: secret, code: "000000"},
+		{name: "8 digit code", secret: secret, code: "14050471"},
+		{name: "empty code", secret: secret},
+		{name: "invalid secret", secret: "not base32!", code: "050471"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			step, ok := matchTOTP(tt.secret, tt.code, now)
+			if step != tt.wantStep || ok != tt.wantOK {
+				t.Errorf("matchTOTP(%q) = %d, %v, want %d, %v", tt.code, step, ok, tt.wantStep, tt.wantOK)
+			}
+		})
+	}
+}
+
+// unreachableDB points the package at a database that refuses connections, so persisting lockouts fails
+// and is only logged.
+func unreachableDB(t *testing.T) {
+	pool, err := pgxpool.New(context.Background(), "postgres://test@127.0.0.1:1/test?connect_timeout=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := dbPool
+	dbPool = pool
+	t.Cleanup(func() {
+		pool.Close()
+		dbPool = previous
+	})
+}
+
+// testThrottle replaces the login throttle for the duration of the test.
+func testThrottle(t *testing.T, maxFailures int, lockout time.Duration) *loginThrottle {
+	previous := throttle
+	throttle = &loginThrottle{attempts: map[string]*loginAttempts{}, maxFailures: maxFailures, lockout: lockout}
+	t.Cleanup(func() { throttle = previous })
+	return throttle
+}
+
+func TestGuardSecondFactorLockout(t *testing.T) {
+	unreachableDB(t)
+	const maxFailures = 3
+	testThrottle(t, maxFailures, 15*time.Minute)
+	user := models.AppUser{ID: 7, Name: "anna"}
+	r := httptest.NewRequest(http.MethodDelete, "/totp", nil)
+	r.RemoteAddr = "192.0.2.1:1234"
+
+	checked := 0
+	wrongCode := func() (bool, error) { checked++; return false, nil }
+	rightCode := func() (bool, error) { checked++; return true, nil }
+	// skipDelay moves the failures back so the growing delay between attempts is over
+	skipDelay := func() {
+		for _, attempts := range throttle.attempts {
+			attempts.last = attempts.last.Add(-loginMaxDelay)
+		}
+	}
+
+	tests := []struct {
+		name        string
+		check       func() (bool, error)
+		skipDelay   bool
+		wantErr     error
+		wantTooMany time.Duration // minimum Retry-After when the attempt is refused
+		wantChecked bool
+	}{
+		{name: "right code", check: rightCode, wantChecked: true},
+		{name: "first wrong code", check: wrongCode, wantErr: ErrInvalidSecondFactor, wantChecked: true},
+		{name: "retry right away", check: rightCode, wantTooMany: time.Millisecond},
+		{name: "second wrong code", check: wrongCode, skipDelay: true, wantErr: ErrInvalidSecondFactor, wantChecked: true},
+		{name: "third wrong code locks", check: wrongCode, skipDelay: true, wantErr: ErrInvalidSecondFactor, wantChecked: true},
+		{name: "locked", check: rightCode, skipDelay: true, wantTooMany: 10 * time.Minute},
+	}
+	for _, tt := range tests {
+		if tt.skipDelay {
+			skipDelay()
+		}
+		before := checked
+		err := guardSecondFactor(r, user, tt.check)
+		if tooMany, ok := errors.AsType[*TooManyAttemptsError](err); tt.wantTooMany > 0 {
+			if !ok || tooMany.RetryAfter < tt.wantTooMany {
+				t.Errorf("%s: guardSecondFactor() error = %v, want to wait at least %v", tt.name, err, tt.wantTooMany)
+			}
+		} else if !errors.Is(err, tt.wantErr) {
+			t.Errorf("%s: guardSecondFactor() error = %v, want %v", tt.name, err, tt.wantErr)
+		}
+		if (checked > before) != tt.wantChecked {
+			t.Errorf("%s: code checked = %v, want %v", tt.name, checked > before, tt.wantChecked)
+		}
+	}
+
+	// The lockout also covers password logins of the user and other users from the same IP
+	if wait := throttle.wait(time.Now(), userKey(user.Name)); wait < 10*time.Minute {
+		t.Errorf("username wait = %v, want the lockout", wait)
+	}
+	if wait := throttle.wait(time.Now(), ipKey("192.0.2.1")); wait < 10*time.Minute {
+		t.Errorf("IP wait = %v, want the lockout", wait)
+	}
+}
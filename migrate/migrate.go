@@ -0,0 +1,381 @@
+// Package migrate applies the embedded SQL migrations. It keeps its bookkeeping in flyway_schema_history like the
+// Flyway CLI did, so databases migrated by Flyway are picked up where they are and the CLI can still inspect them.
+package migrate
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io/fs"
+	"log/slog"
+	"path"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// lockKey is the advisory lock held while migrating, so only one server migrates at a time ("homeapp" in ASCII).
+const lockKey int64 = 0x686f6d65617070
+
+// Migration states, named like the ones of flyway info.
+const (
+	StatePending  = "Pending"
+	StateSuccess  = "Success"
+	StateFailed   = "Failed"
+	StateMissing  = "Missing"
+	StateFuture   = "Future"
+	StateIgnored  = "Ignored"
+	StateBaseline = "Baseline"
+	StateChanged  = "Checksum mismatch"
+)
+
+var fileName = regexp.MustCompile(`^V(\d+(?:[._]\d+)*)__(.+)\.sql$`)
+
+// Migration is one versioned SQL script.
+type Migration struct {
+	Version     string
+	Description string
+	Script      string
+	Checksum    int32
+	parts       []int
+	sql         string
+}
+
+// applied is a row of flyway_schema_history.
+type applied struct {
+	version     string
+	description string
+	script      string
+	kind        string
+	checksum    *int32
+	installedOn time.Time
+	success     bool
+	parts       []int
+}
+
+// Status is the state of one migration, locally and in the database.
+type Status struct {
+	Version     string
+	Description string
+	Script      string
+	State       string
+	InstalledOn *time.Time
+}
+
+// Load reads the migrations in the root of fsys, ordered by version.
+func Load(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+	var migrations []Migration
+	for _, entry := range entries {
+		if entry.IsDir() || path.Ext(entry.Name()) != ".sql" {
+			continue
+		}
+		match := fileName.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("migration %s: name must be V<version>__<description>.sql", entry.Name())
+		}
+		content, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, err
+		}
+		version := strings.ReplaceAll(match[1], "_", ".")
+		migrations = append(migrations, Migration{
+			Version:     version,
+			Description: strings.ReplaceAll(match[2], "_", " "),
+			Script:      entry.Name(),
+			Checksum:    checksum(content),
+			parts:       parseVersion(version),
+			sql:         string(content),
+		})
+	}
+	slices.SortFunc(migrations, func(a, b Migration) int { return compareVersions(a.parts, b.parts) })
+	for i := 1; i < len(migrations); i++ {
+		if compareVersions(migrations[i-1].parts, migrations[i].parts) == 0 {
+			return nil, fmt.Errorf("migrations %s and %s have the same version", migrations[i-1].Script, migrations[i].Script)
+		}
+	}
+	return migrations, nil
+}
+
+// checksum is the CRC32 Flyway stores for SQL migrations. Flyway hashes the script line by line without the
+// line breaks and a leading byte order mark, which is the same as hashing the script without them.
+func checksum(content []byte) int32 {
+	content = bytes.TrimPrefix(content, []byte("\xef\xbb\xbf"))
+	content = bytes.ReplaceAll(content, []byte("\r"), nil)
+	content = bytes.ReplaceAll(content, []byte("\n"), nil)
+	return int32(crc32.ChecksumIEEE(content))
+}
+
+func parseVersion(version string) []int {
+	var parts []int
+	for part := range strings.SplitSeq(version, ".") {
+		n, _ := strconv.Atoi(part)
+		parts = append(parts, n)
+	}
+	// Trailing zeros do not count, 1.0 is the same version as 1
+	for len(parts) > 1 && parts[len(parts)-1] == 0 {
+		parts = parts[:len(parts)-1]
+	}
+	return parts
+}
+
+func compareVersions(a, b []int) int {
+	return slices.Compare(a, b)
+}
+
+// Up applies all pending migrations, each in its own transaction. It validates the applied ones first and
+// fails without changing anything if they do not match the embedded migrations.
+func Up(ctx context.Context, pool *pgxpool.Pool, fsys fs.FS) error {
+	return withLock(ctx, pool, fsys, func(conn *pgx.Conn, migrations []Migration, history []applied) error {
+		statuses := statusOf(migrations, history)
+		if err := validate(statuses); err != nil {
+			return err
+		}
+		pending := map[string]bool{}
+		for _, status := range statuses {
+			pending[status.Script] = status.State == StatePending
+		}
+		count := 0
+		for _, m := range migrations {
+			if !pending[m.Script] {
+				continue
+			}
+			if err := apply(ctx, conn, m); err != nil {
+				return err
+			}
+			count++
+		}
+		if count == 0 {
+			slog.InfoContext(ctx, "Database schema is up to date", "version", currentVersion(statuses))
+		}
+		return nil
+	})
+}
+
+// Validate checks that the applied migrations match the embedded ones and nothing is left pending.
+func Validate(ctx context.Context, pool *pgxpool.Pool, fsys fs.FS) error {
+	statuses, err := Info(ctx, pool, fsys)
+	if err != nil {
+		return err
+	}
+	if err := validate(statuses); err != nil {
+		return err
+	}
+	for _, status := range statuses {
+		if status.State == StatePending {
+			return fmt.Errorf("migration %s is pending", status.Script)
+		}
+	}
+	return nil
+}
+
+// Info returns the state of every migration, applied or not, ordered by version.
+func Info(ctx context.Context, pool *pgxpool.Pool, fsys fs.FS) ([]Status, error) {
+	var statuses []Status
+	err := withLock(ctx, pool, fsys, func(_ *pgx.Conn, migrations []Migration, history []applied) error {
+		statuses = statusOf(migrations, history)
+		return nil
+	})
+	return statuses, err
+}
+
+// withLock runs fn on a single connection holding the migration lock, with the history table in place.
+func withLock(ctx context.Context, pool *pgxpool.Pool, fsys fs.FS, fn func(*pgx.Conn, []Migration, []applied) error) error {
+	migrations, err := Load(fsys)
+	if err != nil {
+		return err
+	}
+	conn, err := pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+	if _, err := conn.Exec(ctx, "SELECT pg_advisory_lock($1)", lockKey); err != nil {
+		return fmt.Errorf("acquire migration lock: %w", err)
+	}
+	defer func() {
+		// A new context, the lock has to be released even when ctx was cancelled
+		if _, err := conn.Exec(context.Background(), "SELECT pg_advisory_unlock($1)", lockKey); err != nil {
+			slog.ErrorContext(ctx, "Failed to release migration lock", "error", err)
+		}
+	}()
+
+	if err := createHistory(ctx, conn.Conn()); err != nil {
+		return err
+	}
+	history, err := loadHistory(ctx, conn.Conn())
+	if err != nil {
+		return err
+	}
+	return fn(conn.Conn(), migrations, history)
+}
+
+// createHistory creates flyway_schema_history the way Flyway does, unless it exists.
+func createHistory(ctx context.Context, conn *pgx.Conn) error {
+	_, err := conn.Exec(ctx, `CREATE TABLE IF NOT EXISTS flyway_schema_history (
+		installed_rank INT NOT NULL,
+		version VARCHAR(50),
+		description VARCHAR(200) NOT NULL,
+		type VARCHAR(20) NOT NULL,
+		script VARCHAR(1000) NOT NULL,
+		checksum INT,
+		installed_by VARCHAR(100) NOT NULL,
+		installed_on TIMESTAMP NOT NULL DEFAULT now(),
+		execution_time INT NOT NULL,
+		success BOOLEAN NOT NULL,
+		CONSTRAINT flyway_schema_history_pk PRIMARY KEY (installed_rank)
+	);
+	CREATE INDEX IF NOT EXISTS flyway_schema_history_s_idx ON flyway_schema_history (success)`)
+	return err
+}
+
+func loadHistory(ctx context.Context, conn *pgx.Conn) ([]applied, error) {
+	// Rows without version, e.g. the schema creation marker of Flyway, are not migrations
+	rows, err := conn.Query(ctx, `SELECT version, description, script, type, checksum, installed_on, success
+		FROM flyway_schema_history WHERE version IS NOT NULL ORDER BY installed_rank`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var history []applied
+	for rows.Next() {
+		var a applied
+		if err := rows.Scan(&a.version, &a.description, &a.script, &a.kind, &a.checksum, &a.installedOn, &a.success); err != nil {
+			return nil, err
+		}
+		a.parts = parseVersion(a.version)
+		history = append(history, a)
+	}
+	return history, rows.Err()
+}
+
+// statusOf matches the embedded migrations with the history.
+func statusOf(migrations []Migration, history []applied) []Status {
+	var statuses []Status
+	var latest, baseline []int
+	for _, a := range history {
+		if a.success && compareVersions(a.parts, latest) > 0 {
+			latest = a.parts
+		}
+		if a.kind == "BASELINE" {
+			baseline = a.parts
+		}
+	}
+	var newest []int
+	if len(migrations) > 0 {
+		newest = migrations[len(migrations)-1].parts
+	}
+
+	for _, m := range migrations {
+		status := Status{Version: m.Version, Description: m.Description, Script: m.Script, State: StatePending}
+		i := slices.IndexFunc(history, func(a applied) bool { return compareVersions(a.parts, m.parts) == 0 })
+		switch {
+		case i >= 0:
+			a := history[i]
+			status.InstalledOn = &a.installedOn
+			switch {
+			case !a.success:
+				status.State = StateFailed
+			case a.kind == "BASELINE":
+				status.State = StateBaseline
+			case a.checksum == nil || *a.checksum != m.Checksum || a.description != m.Description:
+				status.State = StateChanged
+			default:
+				status.State = StateSuccess
+			}
+		case baseline != nil && compareVersions(m.parts, baseline) <= 0:
+			status.State = StateBaseline
+		case compareVersions(m.parts, latest) < 0:
+			status.State = StateIgnored
+		}
+		statuses = append(statuses, status)
+	}
+	for _, a := range history {
+		if slices.ContainsFunc(migrations, func(m Migration) bool { return compareVersions(a.parts, m.parts) == 0 }) {
+			continue
+		}
+		status := Status{Version: a.version, Description: a.description, Script: a.script, State: StateMissing, InstalledOn: &a.installedOn}
+		switch {
+		case a.kind == "BASELINE":
+			status.State = StateBaseline
+		case !a.success:
+			status.State = StateFailed
+		case compareVersions(a.parts, newest) > 0:
+			status.State = StateFuture
+		}
+		statuses = append(statuses, status)
+	}
+	slices.SortStableFunc(statuses, func(a, b Status) int {
+		return compareVersions(parseVersion(a.Version), parseVersion(b.Version))
+	})
+	return statuses
+}
+
+// validate fails on every state Flyway's validate rejects by default. Future migrations were applied by a newer
+// version of the server and are accepted.
+func validate(statuses []Status) error {
+	var errs []error
+	for _, status := range statuses {
+		switch status.State {
+		case StateFailed:
+			errs = append(errs, fmt.Errorf("migration %s failed, repair the schema and remove it from flyway_schema_history", status.Script))
+		case StateChanged:
+			errs = append(errs, fmt.Errorf("migration %s was changed after it was applied", status.Script))
+		case StateMissing:
+			errs = append(errs, fmt.Errorf("applied migration %s is missing", status.Script))
+		case StateIgnored:
+			errs = append(errs, fmt.Errorf("migration %s is older than the applied ones and was not applied", status.Script))
+		case StateFuture:
+			slog.Warn("Database has a migration this server does not know", "version", status.Version, "script", status.Script)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func currentVersion(statuses []Status) string {
+	version := ""
+	for _, status := range statuses {
+		if status.State == StateSuccess || status.State == StateBaseline || status.State == StateFuture {
+			version = status.Version
+		}
+	}
+	return version
+}
+
+// apply runs a migration and records it in one transaction, so a failed migration leaves no trace.
+func apply(ctx context.Context, conn *pgx.Conn, m Migration) error {
+	start := time.Now()
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, m.sql); err != nil {
+		return fmt.Errorf("migration %s: %w", m.Script, err)
+	}
+	elapsed := time.Since(start)
+	_, err = tx.Exec(ctx, `INSERT INTO flyway_schema_history
+		(installed_rank, version, description, type, script, checksum, installed_by, execution_time, success)
+		SELECT COALESCE(MAX(installed_rank), 0) + 1, $1, $2, 'SQL', $3, $4, CURRENT_USER, $5, TRUE FROM flyway_schema_history`,
+		m.Version, m.Description, m.Script, m.Checksum, elapsed.Milliseconds())
+	if err != nil {
+		return fmt.Errorf("record migration %s: %w", m.Script, err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return err
+	}
+	slog.InfoContext(ctx, "Applied migration", "version", m.Version, "description", m.Description, "durationMs", elapsed.Milliseconds())
+	return nil
+}
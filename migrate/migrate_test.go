@@ -0,0 +1,162 @@
+package migrate
+
+import (
+	"slices"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestChecksum(t *testing.T) {
+	// CRC32 of "123456789" is 0xCBF43926
+	const want int32 = -873187034
+	tests := []struct {
+		name    string
+		content string
+		want    int32
+	}{
+		{name: "empty", content: "", want: 0},
+		{name: "single line", content: "123456789", want: want},
+		{name: "lines", content: "1234\n56789\n", want: want},
+		{name: "windows line breaks", content: "1234\r\n56789\r\n", want: want},
+		{name: "byte order mark", content: "\xef\xbb\xbf1234\n56789", want: want},
+		{name: "other content", content: "12345678", want: -1696539985},
+	}
+	for _, tt := range tests {
+		if got := checksum([]byte(tt.content)); got != tt.want {
+			t.Errorf("checksum(%s) = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestParseVersion(t *testing.T) {
+	tests := []struct {
+		version string
+		want    []int
+	}{
+		{version: "1", want: []int{1}},
+		{version: "1.2", want: []int{1, 2}},
+		{version: "1.0", want: []int{1}},
+		{version: "1.0.0", want: []int{1}},
+		{version: "2.0.1", want: []int{2, 0, 1}},
+		{version: "0", want: []int{0}},
+		{version: "10.02", want: []int{10, 2}},
+	}
+	for _, tt := range tests {
+		if got := parseVersion(tt.version); !slices.Equal(got, tt.want) {
+			t.Errorf("parseVersion(%q) = %v, want %v", tt.version, got, tt.want)
+		}
+	}
+
+	ordered := []string{"0.9", "1", "1.0.1", "1.2", "1.10", "2"}
+	for i := 1; i < len(ordered); i++ {
+		if compareVersions(parseVersion(ordered[i-1]), parseVersion(ordered[i])) >= 0 {
+			t.Errorf("version %s is not older than %s", ordered[i-1], ordered[i])
+		}
+	}
+}
+
+func TestLoad(t *testing.T) {
+	tests := []struct {
+		name     string
+		files    fstest.MapFS
+		want     []string
+		wantDesc string
+		wantErr  bool
+	}{
+		{
+			name: "ordered by version",
+			files: fstest.MapFS{
+				"V10__later.sql":      {Data: []byte("SELECT 10;")},
+				"V2__second.sql":      {Data: []byte("SELECT 2;")},
+				"V1_1__add_users.sql": {Data: []byte("SELECT 1.1;")},
+				"V1__init.sql":        {Data: []byte("SELECT 1;")},
+				"README.md":           {Data: []byte("not a migration")},
+				"archive/V9__old.sql": {Data: []byte("SELECT 9;")},
+			},
+			want:     []string{"1", "1.1", "2", "10"},
+			wantDesc: "add users",
+		},
+		{name: "invalid name", files: fstest.MapFS{"init.sql": {Data: []byte("SELECT 1;")}}, wantErr: true},
+		{
+			name:    "same version",
+			files:   fstest.MapFS{"V1__init.sql": {}, "V1.0__again.sql": {}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			migrations, err := Load(tt.files)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Load() error = %v, want error %v", err, tt.wantErr)
+			}
+			var versions []string
+			for _, m := range migrations {
+				versions = append(versions, m.Version)
+			}
+			if !slices.Equal(versions, tt.want) {
+				t.Errorf("Load() versions = %v, want %v", versions, tt.want)
+			}
+			if tt.wantDesc != "" && migrations[1].Description != tt.wantDesc {
+				t.Errorf("Load() description = %q, want %q", migrations[1].Description, tt.wantDesc)
+			}
+		})
+	}
+}
+
+func TestStatusOf(t *testing.T) {
+	migration := func(version string) Migration {
+		return Migration{Version: version, Description: "v" + version, Script: "V" + version + "__v" + version + ".sql",
+			Checksum: int32(len(version)), parts: parseVersion(version)}
+	}
+	ran := func(version string) applied {
+		m := migration(version)
+		return applied{version: version, description: m.Description, script: m.Script, kind: "SQL", checksum: &m.Checksum,
+			installedOn: time.Now(), success: true, parts: m.parts}
+	}
+	failed := ran("2")
+	failed.success = false
+	changed := ran("2")
+	changed.checksum = new(int32)
+	renamed := ran("2")
+	renamed.description = "other"
+	baseline := ran("2")
+	baseline.kind = "BASELINE"
+	baseline.checksum = nil
+
+	migrations := []Migration{migration("1"), migration("2"), migration("3")}
+	tests := []struct {
+		name       string
+		migrations []Migration
+		history    []applied
+		want       []string
+		wantErr    bool
+	}{
+		{name: "new database", migrations: migrations, want: []string{"1 Pending", "2 Pending", "3 Pending"}},
+		{name: "partly applied", migrations: migrations, history: []applied{ran("1")}, want: []string{"1 Success", "2 Pending", "3 Pending"}},
+		{name: "all applied", migrations: migrations, history: []applied{ran("1"), ran("2"), ran("3")}, want: []string{"1 Success", "2 Success", "3 Success"}},
+		{name: "failed", migrations: migrations, history: []applied{ran("1"), failed}, want: []string{"1 Success", "2 Failed", "3 Pending"}, wantErr: true},
+		{name: "changed", migrations: migrations, history: []applied{ran("1"), changed}, want: []string{"1 Success", "2 Checksum mismatch", "3 Pending"}, wantErr: true},
+		{name: "renamed", migrations: migrations, history: []applied{ran("1"), renamed}, want: []string{"1 Success", "2 Checksum mismatch", "3 Pending"}, wantErr: true},
+		{name: "skipped", migrations: migrations, history: []applied{ran("1"), ran("3")}, want: []string{"1 Success", "2 Ignored", "3 Success"}, wantErr: true},
+		{name: "missing", migrations: migrations[1:], history: []applied{ran("1"), ran("2")}, want: []string{"1 Missing", "2 Success", "3 Pending"}, wantErr: true},
+		{name: "future", migrations: migrations[:2], history: []applied{ran("1"), ran("2"), ran("3")}, want: []string{"1 Success", "2 Success", "3 Future"}},
+		{name: "baseline", migrations: migrations, history: []applied{baseline}, want: []string{"1 Baseline", "2 Baseline", "3 Pending"}},
+		{name: "baseline without script", migrations: migrations[2:], history: []applied{baseline}, want: []string{"2 Baseline", "3 Pending"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			statuses := statusOf(tt.migrations, tt.history)
+			var got []string
+			for _, status := range statuses {
+				got = append(got, status.Version+" "+status.State)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("statusOf() = %v, want %v", got, tt.want)
+			}
+			if err := validate(statuses); (err != nil) != tt.wantErr {
+				t.Errorf("validate() error = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -2,21 +2,211 @@ package models
 
 import (
 	"fmt"
+	"log/slog"
 	"time"
 )
 
+// AccessLevel is the role of a user, the permissions of each role are stored in the role_permissions table.
 type AccessLevel string
 
 const (
-	Admin AccessLevel = "admin"
-	User  AccessLevel = "user"
+	Parent      AccessLevel = "parent"
+	Child       AccessLevel = "child"
+	Grandparent AccessLevel = "grandparent"
+	Guest       AccessLevel = "guest"
+	// Superadmin manages the households hosted on the server
+	Superadmin AccessLevel = "superadmin"
 )
 
+// Normalize maps the access levels used before roles existed ("admin" and "user") onto the matching roles.
+func (a AccessLevel) Normalize() AccessLevel {
+	switch a {
+	case "admin":
+		return Parent
+	case "user":
+		return Child
+	}
+	return a
+}
+
+type Permission string
+
+const (
+	PermUsersRead              Permission = "users.read"
+	PermUsersManage            Permission = "users.manage"
+	PermChangePassword         Permission = "account.changePassword"
+	PermPocketMoneyReadOwn     Permission = "pocketMoney.readOwn"
+	PermPocketMoneyReadAll     Permission = "pocketMoney.readAll"
+	PermPocketMoneyCreate      Permission = "pocketMoney.create"
+	PermPocketMoneyAcknowledge Permission = "pocketMoney.acknowledge"
+	PermPocketMoneySchedules   Permission = "pocketMoney.schedules"
+	PermGoalsManage            Permission = "goals.manage"
+	PermMusicListen            Permission = "music.listen"
+	PermMusicManage            Permission = "music.manage"
+	PermPlaylistsManage        Permission = "playlists.manage"
+	PermPlaylistsCurate        Permission = "playlists.curate"
+	PermHouseholdsManage       Permission = "households.manage"
+)
+
+type Role struct {
+	Name        AccessLevel  `json:"name"`
+	Description string       `json:"description"`
+	Permissions []Permission `json:"permissions"`
+}
+
 type AppUser struct {
-	ID       int
-	Name     string
-	Access   AccessLevel
-	Password string
+	ID          int
+	Name        string
+	Access      AccessLevel
+	Password    string
+	HouseholdID int
+	TOTPEnabled bool
+	Active      bool
+	// MustChangePassword is set for the seeded admin and after an admin reset the password.
+	MustChangePassword bool
+	// SessionID is set when the user authenticated with a bearer token.
+	SessionID string `json:"-"`
+	// AuthMethod is how the session was opened, "password" or "pin".
+	AuthMethod string `json:"-"`
+	// DeviceID is the registered device the session is bound to, if any.
+	DeviceID string `json:"-"`
+}
+
+// LogValue keeps the password out of logs.
+func (u AppUser) LogValue() slog.Value {
+	return slog.GroupValue(slog.Int("id", u.ID), slog.String("name", u.Name), slog.String("access", string(u.Access)),
+		slog.Int("householdId", u.HouseholdID))
+}
+
+// Tokens is the pair of credentials handed out by /login and /token/refresh.
+type Tokens struct {
+	AccessToken  string    `json:"accessToken"`
+	RefreshToken string    `json:"refreshToken"`
+	ExpiresAt    time.Time `json:"expiresAt"`
+}
+
+// LoginResponse keeps the user fields at the top level so existing clients keep working.
+type LoginResponse struct {
+	AppUser
+	Tokens
+	Permissions []Permission `json:"permissions"`
+	// TOTPEnrollmentRequired is set when the role requires a second factor the user has not set up yet.
+	// Until then the tokens are only accepted by the /totp endpoints.
+	TOTPEnrollmentRequired bool `json:"totpEnrollmentRequired,omitempty"`
+	// PasswordChangeRequired is set until the user replaced a password they did not choose themselves.
+	PasswordChangeRequired bool `json:"passwordChangeRequired,omitempty"`
+}
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refreshToken"`
+}
+
+// PolicyViolation is one password rule a new password breaks.
+type PolicyViolation struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Problem is the body of every error response, an RFC 7807 problem detail. Code is stable and meant for clients
+// to look up a localised message, Detail is the English message and Details carries code specific data.
+type Problem struct {
+	Type      string `json:"type"`
+	Title     string `json:"title"`
+	Status    int    `json:"status"`
+	Detail    string `json:"detail,omitempty"`
+	Instance  string `json:"instance,omitempty"`
+	Code      string `json:"code"`
+	Details   any    `json:"details,omitempty"`
+	RequestID string `json:"requestId,omitempty"`
+}
+
+// DeviceRegistration is returned once when a device is registered, the token is not stored in plain text.
+type DeviceRegistration struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	DeviceToken string `json:"deviceToken"`
+}
+
+// Device is a registered client install of a user.
+type Device struct {
+	ID         string     `json:"id"`
+	UserID     int        `json:"userId"`
+	Name       string     `json:"name"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	LastSeenAt *time.Time `json:"lastSeenAt,omitempty"`
+	LastIP     *string    `json:"lastIp,omitempty"`
+	RevokedAt  *time.Time `json:"revokedAt,omitempty"`
+	// Current marks the device the request was sent from.
+	Current bool `json:"current"`
+}
+
+type DeviceRequest struct {
+	Name string `json:"name"`
+}
+
+type PINRequest struct {
+	PIN string `json:"pin"`
+}
+
+// PINLoginRequest is sent by the child picker of a registered device.
+type PINLoginRequest struct {
+	UserID int    `json:"userId"`
+	PIN    string `json:"pin"`
+}
+
+// UpdateUserRequest changes only the fields that are set.
+type UpdateUserRequest struct {
+	Name   *string      `json:"name"`
+	Access *AccessLevel `json:"access"`
+	Active *bool        `json:"active"`
+}
+
+type PasswordResetRequest struct {
+	Password string `json:"password"`
+}
+
+// DeleteUserSummary lists the data that is deleted together with a user.
+type DeleteUserSummary struct {
+	PocketMoneyEntries int  `json:"pocketMoneyEntries"`
+	Schedules          int  `json:"schedules"`
+	SavingsGoals       int  `json:"savingsGoals"`
+	Playlists          int  `json:"playlists"`
+	Deleted            bool `json:"deleted"`
+}
+
+// TOTPEnrollment is the secret of a new authenticator, otpauthUri is meant to be shown as QR code.
+type TOTPEnrollment struct {
+	Secret     string `json:"secret"`
+	OTPAuthURI string `json:"otpauthUri"`
+}
+
+type TOTPCodeRequest struct {
+	Code string `json:"code"`
+}
+
+// RecoveryCodes can each be used once instead of a TOTP code. They are only shown when generated.
+type RecoveryCodes struct {
+	Codes []string `json:"recoveryCodes"`
+}
+
+// LockoutEvent records that logins for a username or from an IP were locked after too many failures.
+type LockoutEvent struct {
+	ID          int        `json:"id"`
+	UserID      *int       `json:"userId,omitempty"`
+	Username    string     `json:"username"`
+	IPAddress   string     `json:"ipAddress"`
+	Reason      string     `json:"reason"`
+	Failures    int        `json:"failures"`
+	LockedUntil time.Time  `json:"lockedUntil"`
+	CreatedAt   time.Time  `json:"createdAt"`
+	UnlockedAt  *time.Time `json:"unlockedAt,omitempty"`
+	UnlockedBy  *int       `json:"unlockedBy,omitempty"`
+}
+
+// Household groups the users, pocket money and playlists of one family.
+type Household struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
 }
 
 type Action struct {
@@ -0,0 +1,278 @@
+package music
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// id3Tags holds the parts of ID3v1/ID3v2 tags the library is interested in.
+type id3Tags struct {
+	title       string
+	artist      string
+	album       string
+	trackNumber int
+	// durationMs from the TLEN frame, 0 if not present
+	durationMs int
+	cover      []byte
+	coverMime  string
+}
+
+// readID3 reads the ID3v2 tag at the start of the file and fills missing fields from an ID3v1 tag at the end.
+func readID3(r io.ReaderAt, size int64) id3Tags {
+	var tags id3Tags
+	readID3v2(r, size, &tags)
+	if tags.title == "" || tags.artist == "" || tags.album == "" || tags.trackNumber == 0 {
+		readID3v1(r, size, &tags)
+	}
+	return tags
+}
+
+func readID3v2(r io.ReaderAt, size int64, tags *id3Tags) {
+	header := make([]byte, 10)
+	if _, err := r.ReadAt(header, 0); err != nil || !bytes.Equal(header[:3], []byte("ID3")) {
+		return
+	}
+	version := header[3]
+	flags := header[5]
+	if version < 2 || version > 4 {
+		return
+	}
+	tagSize := int64(syncsafe(header[6:10]))
+	if tagSize > size-10 {
+		// The size comes from the file, a broken header must not allocate more than the file holds
+		tagSize = max(size-10, 0)
+	}
+	body := make([]byte, tagSize)
+	if _, err := r.ReadAt(body, 10); err != nil && err != io.EOF {
+		return
+	}
+	if version < 4 && flags&0x80 != 0 {
+		// Tag-wide unsynchronisation, ID3v2.4 applies it per frame instead
+		body = removeUnsync(body)
+	}
+	if version > 2 && flags&0x40 != 0 && len(body) >= 4 {
+		// Skip the extended header
+		extSize := int(binary.BigEndian.Uint32(body[:4]))
+		if version == 4 {
+			extSize = int(syncsafe(body[:4]))
+		} else {
+			extSize += 4
+		}
+		if extSize > len(body) {
+			return
+		}
+		body = body[extSize:]
+	}
+
+	idLen, headerLen := 4, 10
+	if version == 2 {
+		idLen, headerLen = 3, 6
+	}
+	for len(body) >= headerLen && body[0] != 0 {
+		id := string(body[:idLen])
+		var frameSize int
+		var frameFlags uint16
+		switch version {
+		case 2:
+			frameSize = int(body[3])<<16 | int(body[4])<<8 | int(body[5])
+		case 3:
+			frameSize = int(binary.BigEndian.Uint32(body[4:8]))
+			frameFlags = binary.BigEndian.Uint16(body[8:10])
+		default:
+			frameSize = int(syncsafe(body[4:8]))
+			frameFlags = binary.BigEndian.Uint16(body[8:10])
+		}
+		if frameSize <= 0 || headerLen+frameSize > len(body) {
+			return
+		}
+		data := body[headerLen : headerLen+frameSize]
+		body = body[headerLen+frameSize:]
+
+		if version == 4 && frameFlags&0x0002 != 0 {
+			data = removeUnsync(data)
+		}
+		// Compressed or encrypted frames are skipped
+		if (version == 3 && frameFlags&0x00C0 != 0) || (version == 4 && frameFlags&0x000C != 0) {
+			continue
+		}
+
+		switch id {
+		case "TIT2", "TT2":
+			tags.title = decodeText(data)
+		case "TPE1", "TP1":
+			tags.artist = decodeText(data)
+		case "TALB", "TAL":
+			tags.album = decodeText(data)
+		case "TRCK", "TRK":
+			tags.trackNumber = parseTrackNumber(decodeText(data))
+		case "TLEN", "TLE":
+			tags.durationMs, _ = strconv.Atoi(decodeText(data))
+		case "APIC":
+			if tags.cover == nil {
+				tags.cover, tags.coverMime = parseAPIC(data)
+			}
+		case "PIC":
+			if tags.cover == nil {
+				tags.cover, tags.coverMime = parsePIC(data)
+			}
+		}
+	}
+}
+
+func readID3v1(r io.ReaderAt, size int64, tags *id3Tags) {
+	if size < 128 {
+		return
+	}
+	tag := make([]byte, 128)
+	if _, err := r.ReadAt(tag, size-128); err != nil || !bytes.Equal(tag[:3], []byte("TAG")) {
+		return
+	}
+	field := func(b []byte) string {
+		return strings.TrimSpace(decodeLatin1(bytes.TrimRight(b, "\x00")))
+	}
+	if tags.title == "" {
+		tags.title = field(tag[3:33])
+	}
+	if tags.artist == "" {
+		tags.artist = field(tag[33:63])
+	}
+	if tags.album == "" {
+		tags.album = field(tag[63:93])
+	}
+	// ID3v1.1 stores the track number in the last byte of the comment
+	if tags.trackNumber == 0 && tag[125] == 0 && tag[126] != 0 {
+		tags.trackNumber = int(tag[126])
+	}
+}
+
+// parseAPIC splits an ID3v2.3/2.4 attached picture frame into image data and MIME type.
+func parseAPIC(data []byte) ([]byte, string) {
+	if len(data) < 2 {
+		return nil, ""
+	}
+	encoding := data[0]
+	mimeEnd := bytes.IndexByte(data[1:], 0)
+	if mimeEnd < 0 {
+		return nil, ""
+	}
+	mime := string(data[1 : 1+mimeEnd])
+	rest := data[1+mimeEnd+1:]
+	if len(rest) < 1 {
+		return nil, ""
+	}
+	// Skip picture type and description
+	picture := skipTerminated(rest[1:], encoding)
+	if len(picture) == 0 {
+		return nil, ""
+	}
+	if mime == "" || !strings.Contains(mime, "/") {
+		mime = "image/" + strings.ToLower(mime)
+	}
+	return picture, mime
+}
+
+// parsePIC handles the ID3v2.2 variant which uses a three letter image format instead of a MIME type.
+func parsePIC(data []byte) ([]byte, string) {
+	if len(data) < 5 {
+		return nil, ""
+	}
+	encoding := data[0]
+	format := strings.ToLower(string(data[1:4]))
+	picture := skipTerminated(data[5:], encoding)
+	if len(picture) == 0 {
+		return nil, ""
+	}
+	if format == "jpg" {
+		format = "jpeg"
+	}
+	return picture, "image/" + format
+}
+
+// skipTerminated drops a null-terminated string in the given text encoding from the start of b.
+func skipTerminated(b []byte, encoding byte) []byte {
+	if encoding == 1 || encoding == 2 {
+		for i := 0; i+1 < len(b); i += 2 {
+			if b[i] == 0 && b[i+1] == 0 {
+				return b[i+2:]
+			}
+		}
+		return nil
+	}
+	i := bytes.IndexByte(b, 0)
+	if i < 0 {
+		return nil
+	}
+	return b[i+1:]
+}
+
+// decodeText decodes an ID3v2 text frame, the first byte selects the encoding.
+func decodeText(data []byte) string {
+	if len(data) == 0 {
+		return ""
+	}
+	encoding, text := data[0], data[1:]
+	var s string
+	switch encoding {
+	case 0:
+		s = decodeLatin1(text)
+	case 1:
+		s = decodeUTF16(text, true)
+	case 2:
+		s = decodeUTF16(text, false)
+	default:
+		s = string(text)
+	}
+	// Multiple values are separated by null characters, only the first one is used
+	if i := strings.IndexRune(s, 0); i >= 0 {
+		s = s[:i]
+	}
+	return strings.TrimSpace(s)
+}
+
+func decodeLatin1(b []byte) string {
+	runes := make([]rune, len(b))
+	for i, c := range b {
+		runes[i] = rune(c)
+	}
+	return string(runes)
+}
+
+func decodeUTF16(b []byte, withBOM bool) string {
+	bigEndian := true
+	if withBOM && len(b) >= 2 {
+		switch {
+		case b[0] == 0xFF && b[1] == 0xFE:
+			bigEndian = false
+			b = b[2:]
+		case b[0] == 0xFE && b[1] == 0xFF:
+			b = b[2:]
+		}
+	}
+	units := make([]uint16, len(b)/2)
+	for i := range units {
+		if bigEndian {
+			units[i] = binary.BigEndian.Uint16(b[2*i:])
+		} else {
+			units[i] = binary.LittleEndian.Uint16(b[2*i:])
+		}
+	}
+	return string(utf16.Decode(units))
+}
+
+// parseTrackNumber reads values like "3" or "3/12".
+func parseTrackNumber(s string) int {
+	number, _, _ := strings.Cut(s, "/")
+	n, err := strconv.Atoi(strings.TrimSpace(number))
+	if err != nil {
+		return 0
+	}
+	return n
+}
+
+func removeUnsync(b []byte) []byte {
+	return bytes.ReplaceAll(b, []byte{0xFF, 0x00}, []byte{0xFF})
+}
@@ -0,0 +1,258 @@
+package music
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"homeApplications/middleware"
+	"homeApplications/models"
+	musicModels "homeApplications/music/models"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var (
+	dbPool *pgxpool.Pool
+	// scanMu prevents the periodic scan and a manual rescan from running at the same time
+	scanMu sync.Mutex
+)
+
+func SetDBConnection(pool *pgxpool.Pool) {
+	dbPool = pool
+}
+
+// maxTagLength is the length of the VARCHAR columns holding ID3 texts, which are unbounded in the file.
+const maxTagLength = 255
+
+type indexedFile struct {
+	diskName   string
+	size       int64
+	modifiedAt time.Time
+}
+
+// RunLibraryScanner indexes the music directory on start and then periodically until ctx is cancelled.
+func RunLibraryScanner(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if result, err := ScanLibrary(ctx); err != nil {
+			slog.ErrorContext(ctx, "Library scan failed", "error", err)
+		} else if result.Added+result.Updated+result.Removed > 0 {
+			slog.InfoContext(ctx, "Library scan finished", "added", result.Added, "updated", result.Updated, "removed", result.Removed)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// ScanLibrary brings the songs table in line with the music directory. Files whose size and modification time
+// did not change since the last scan are not read again.
+func ScanLibrary(ctx context.Context) (musicModels.ScanResult, error) {
+	scanMu.Lock()
+	defer scanMu.Unlock()
+
+	var result musicModels.ScanResult
+	entries, err := os.ReadDir(musicDir)
+	if err != nil {
+		return result, err
+	}
+
+	existing := make(map[string]indexedFile)
+	rows, err := dbPool.Query(ctx, "SELECT file_name, disk_file_name, file_size, modified_at FROM songs")
+	if err != nil {
+		return result, err
+	}
+	for rows.Next() {
+		var name string
+		var file indexedFile
+		if err := rows.Scan(&name, &file.diskName, &file.size, &file.modifiedAt); err != nil {
+			rows.Close()
+			return result, err
+		}
+		existing[name] = file
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return result, err
+	}
+
+	seen := make([]string, 0, len(entries))
+	indexed := make(map[string]bool, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.EqualFold(filepath.Ext(entry.Name()), FILE_EXTENSION) {
+			continue
+		}
+		name := strings.TrimSuffix(entry.Name(), filepath.Ext(entry.Name()))
+		info, err := entry.Info()
+		if err != nil {
+			slog.WarnContext(ctx, "Failed to stat file", "file", entry.Name(), "error", err)
+			continue
+		}
+		// The URLs only carry the name, so a.mp3 and a.MP3 cannot both be in the library
+		if indexed[name] {
+			slog.WarnContext(ctx, "Skipping file with the name of another song", "file", entry.Name())
+			continue
+		}
+		seen = append(seen, name)
+		indexed[name] = true
+
+		// Postgres stores timestamps with microsecond precision
+		modifiedAt := info.ModTime().Truncate(time.Microsecond)
+		old, known := existing[name]
+		if known && old.diskName == entry.Name() && old.size == info.Size() && old.modifiedAt.Equal(modifiedAt) {
+			result.Unchanged++
+			continue
+		}
+		if err := indexFile(ctx, name, entry.Name(), info.Size(), modifiedAt); err != nil {
+			slog.WarnContext(ctx, "Failed to index file", "file", entry.Name(), "error", err)
+			continue
+		}
+		if known {
+			result.Updated++
+		} else {
+			result.Added++
+		}
+	}
+
+	// An empty directory is far more likely an unmounted disk than a deleted library. Removing the songs
+	// would also empty every playlist, so they are kept until the files are back.
+	if len(seen) == 0 && len(existing) > 0 {
+		slog.WarnContext(ctx, "Music directory has no songs, keeping the library", "dir", musicDir, "songs", len(existing))
+		return result, nil
+	}
+	tag, err := dbPool.Exec(ctx, "DELETE FROM songs WHERE NOT (file_name = ANY($1))", seen)
+	if err != nil {
+		return result, err
+	}
+	result.Removed = int(tag.RowsAffected())
+	return result, nil
+}
+
+func indexFile(ctx context.Context, name, fileName string, size int64, modifiedAt time.Time) error {
+	file, err := os.Open(filepath.Join(musicDir, fileName))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	tags := readID3(file, size)
+	if tags.title == "" {
+		tags.title = name
+	}
+	tags.title = truncate(tags.title, maxTagLength)
+	tags.artist = truncate(tags.artist, maxTagLength)
+	tags.album = truncate(tags.album, maxTagLength)
+	if tags.durationMs == 0 {
+		if info, err := analyzeMP3(file, size); err == nil {
+			tags.durationMs = int(info.duration.Milliseconds())
+		}
+	}
+
+	tx, err := dbPool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	var songID int
+	err = tx.QueryRow(ctx, `INSERT INTO songs (file_name, disk_file_name, title, artist, album, track_number, duration_ms, file_size, modified_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		ON CONFLICT (file_name) DO UPDATE SET disk_file_name = EXCLUDED.disk_file_name, title = EXCLUDED.title, artist = EXCLUDED.artist, album = EXCLUDED.album,
+			track_number = EXCLUDED.track_number, duration_ms = EXCLUDED.duration_ms, file_size = EXCLUDED.file_size,
+			modified_at = EXCLUDED.modified_at, indexed_at = NOW()
+		RETURNING id`,
+		name, fileName, tags.title, tags.artist, tags.album, tags.trackNumber, tags.durationMs, size, modifiedAt).Scan(&songID)
+	if err != nil {
+		return err
+	}
+
+	if tags.cover != nil {
+		_, err = tx.Exec(ctx, `INSERT INTO song_covers (song_id, mime_type, data) VALUES ($1, $2, $3)
+			ON CONFLICT (song_id) DO UPDATE SET mime_type = EXCLUDED.mime_type, data = EXCLUDED.data`, songID, tags.coverMime, tags.cover)
+	} else {
+		_, err = tx.Exec(ctx, "DELETE FROM song_covers WHERE song_id=$1", songID)
+	}
+	if err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// truncate shortens s to at most n characters without splitting one.
+func truncate(s string, n int) string {
+	i := 0
+	for pos := range s {
+		if i == n {
+			return s[:pos]
+		}
+		i++
+	}
+	return s
+}
+
+// RescanLibrary lets an admin trigger a scan right after copying new files.
+func RescanLibrary(w http.ResponseWriter, r *http.Request) {
+	middleware.EnableCors(&w)
+	if r.Method != http.MethodPost {
+		middleware.WriteError(w, r, middleware.ErrMethodNotAllowed)
+		return
+	}
+	_, err := middleware.CheckAuthorization(r, models.PermMusicManage)
+	if err != nil {
+		middleware.WriteError(w, r, err)
+		return
+	}
+
+	result, err := ScanLibrary(r.Context())
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Library scan failed", "error", err)
+		middleware.WriteError(w, r, middleware.ErrInternal)
+		return
+	}
+	json.NewEncoder(w).Encode(result)
+}
+
+// GetCover returns the embedded cover art of a song.
+func GetCover(w http.ResponseWriter, r *http.Request) {
+	middleware.EnableCors(&w)
+	_, err := middleware.CheckAuthorization(r, models.PermMusicListen)
+	if err != nil {
+		middleware.WriteError(w, r, err)
+		return
+	}
+
+	songID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		middleware.WriteError(w, r, middleware.NewError(http.StatusBadRequest, "invalid_song_id", "Invalid song ID"))
+		return
+	}
+
+	var mimeType string
+	var data []byte
+	err = dbPool.QueryRow(r.Context(), "SELECT mime_type, data FROM song_covers WHERE song_id=$1", songID).Scan(&mimeType, &data)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			middleware.WriteError(w, r, middleware.NewError(http.StatusNotFound, "cover_not_found", "Cover not found"))
+			return
+		}
+		slog.ErrorContext(r.Context(), "Failed to execute query", "error", err)
+		middleware.WriteError(w, r, middleware.ErrInternal)
+		return
+	}
+	w.Header().Set("Content-Type", mimeType)
+	w.Header().Set("Cache-Control", "private, max-age=86400")
+	w.Write(data)
+}
@@ -0,0 +1,49 @@
+package music
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+func TestTruncate(t *testing.T) {
+	tests := []struct {
+		value string
+		n     int
+		want  string
+	}{
+		{value: "", n: 3, want: ""},
+		{value: "abc", n: 3, want: "abc"},
+		{value: "abcd", n: 3, want: "abc"},
+		{value: "Ärger über Öl", n: 7, want: "Ärger ü"},
+		{value: "日本語の歌", n: 3, want: "日本語"},
+		{value: strings.Repeat("ß", 300), n: maxTagLength, want: strings.Repeat("ß", maxTagLength)},
+	}
+	for _, tt := range tests {
+		if got := truncate(tt.value, tt.n); got != tt.want {
+			t.Errorf("truncate(%q, %d) = %q, want %q", tt.value, tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestSongPathWithoutDatabase(t *testing.T) {
+	pool, err := pgxpool.New(context.Background(), "postgres://test@127.0.0.1:1/test?connect_timeout=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := dbPool
+	dbPool = pool
+	t.Cleanup(func() {
+		pool.Close()
+		dbPool = previous
+	})
+	SetLibrary("library", DefaultBufferSize)
+	t.Cleanup(func() { SetLibrary(DefaultMusicDir, DefaultBufferSize) })
+
+	if got, want := songPath(context.Background(), "Song"), filepath.Join("library", "Song.mp3"); got != want {
+		t.Errorf("songPath() = %q, want %q", got, want)
+	}
+}
@@ -1,9 +1,61 @@
 package models
 
+import "time"
+
 type Song struct {
+	ID    int    `json:"id"`
 	Title string `json:"title"`
+	// FileName is the name without extension used for /audioUrl/
+	FileName    string `json:"fileName"`
+	Artist      string `json:"artist"`
+	Album       string `json:"album"`
+	TrackNumber int    `json:"trackNumber"`
+	DurationMs  int    `json:"durationMs"`
+	HasCover    bool   `json:"hasCover"`
 }
 
 type Songs struct {
 	Songs []Song `json:"songs"`
 }
+
+type StreamURL struct {
+	URL       string    `json:"url"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+type ScanResult struct {
+	Added     int `json:"added"`
+	Updated   int `json:"updated"`
+	Removed   int `json:"removed"`
+	Unchanged int `json:"unchanged"`
+}
+
+type Playlist struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+	// OwnerUserID is nil for shared household playlists
+	OwnerUserID *int            `json:"ownerUserId"`
+	Shared      bool            `json:"shared"`
+	Tracks      []PlaylistTrack `json:"tracks,omitempty"`
+}
+
+type PlaylistTrack struct {
+	ID       int  `json:"id"`
+	Position int  `json:"position"`
+	Song     Song `json:"song"`
+}
+
+type PlaylistRequest struct {
+	Name   string `json:"name"`
+	Shared bool   `json:"shared"`
+}
+
+type AddTrackRequest struct {
+	SongID int `json:"songId"`
+	// Position is optional, the track is appended when it is nil
+	Position *int `json:"position"`
+}
+
+type ReorderRequest struct {
+	TrackIDs []int `json:"trackIds"`
+}
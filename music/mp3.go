@@ -0,0 +1,237 @@
+package music
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"time"
+)
+
+// maxFrameSearch limits how far after the ID3v2 tag we look for the first MPEG frame.
+const maxFrameSearch = 64 * 1024
+
+// mp3Info describes the audio stream of an MP3 file, as far as needed to pace and index it.
+type mp3Info struct {
+	// audioStart is the offset of the first MPEG frame, i.e. the size of a leading ID3v2 tag
+	audioStart int64
+	// bitrate in bits per second, the average for VBR files
+	bitrate  int
+	duration time.Duration
+	vbr      bool
+}
+
+type frameHeader struct {
+	mpegVersion     int // 1, 2 or 25 for MPEG 2.5
+	layer           int
+	bitrate         int // bits per second
+	sampleRate      int
+	padding         int
+	mono            bool
+	samplesPerFrame int
+}
+
+var (
+	// bitrates in kbit/s, indexed by [mpeg1 ? 0 : 1][layer-1][index]
+	bitrateTable = [2][3][16]int{
+		{
+			{0, 32, 64, 96, 128, 160, 192, 224, 256, 288, 320, 352, 384, 416, 448, 0},
+			{0, 32, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 384, 0},
+			{0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 0},
+		},
+		{
+			{0, 32, 48, 56, 64, 80, 96, 112, 128, 144, 160, 176, 192, 224, 256, 0},
+			{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160, 0},
+			{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160, 0},
+		},
+	}
+	sampleRateTable = map[int][3]int{
+		1:  {44100, 48000, 32000},
+		2:  {22050, 24000, 16000},
+		25: {11025, 12000, 8000},
+	}
+	errNoFrame = errors.New("no MPEG frame found")
+)
+
+// analyzeMP3 reads the frame headers of an MP3 file. The bitrate of CBR files is taken from the first frame,
+// VBR files are recognised by their Xing or VBRI header which carries the total number of frames.
+func analyzeMP3(r io.ReaderAt, size int64) (mp3Info, error) {
+	var info mp3Info
+	start, err := id3v2Size(r)
+	if err != nil {
+		return info, err
+	}
+
+	buf := make([]byte, min(maxFrameSearch, max(size-start, 0)))
+	n, err := r.ReadAt(buf, start)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return info, err
+	}
+	buf = buf[:n]
+
+	offset, header, ok := findFrame(buf)
+	if !ok {
+		return info, errNoFrame
+	}
+	info.audioStart = start + int64(offset)
+	audioBytes := size - info.audioStart
+	if hasID3v1(r, size) {
+		audioBytes -= 128
+	}
+
+	frame := buf[offset:]
+	if frames, vbr, ok := frameCount(frame, header); ok && frames > 0 {
+		info.vbr = vbr
+		seconds := float64(frames) * float64(header.samplesPerFrame) / float64(header.sampleRate)
+		info.duration = time.Duration(seconds * float64(time.Second))
+		if seconds > 0 {
+			info.bitrate = int(float64(audioBytes) * 8 / seconds)
+		}
+		return info, nil
+	}
+
+	info.bitrate = header.bitrate
+	info.duration = time.Duration(float64(audioBytes) * 8 / float64(header.bitrate) * float64(time.Second))
+	return info, nil
+}
+
+// id3v2Size returns the number of bytes taken by a leading ID3v2 tag, 0 if there is none.
+func id3v2Size(r io.ReaderAt) (int64, error) {
+	header := make([]byte, 10)
+	if _, err := r.ReadAt(header, 0); err != nil {
+		if errors.Is(err, io.EOF) {
+			return 0, errNoFrame
+		}
+		return 0, err
+	}
+	if !bytes.Equal(header[:3], []byte("ID3")) {
+		return 0, nil
+	}
+	size := int64(syncsafe(header[6:10])) + 10
+	if header[5]&0x10 != 0 {
+		// footer present
+		size += 10
+	}
+	return size, nil
+}
+
+func hasID3v1(r io.ReaderAt, size int64) bool {
+	if size < 128 {
+		return false
+	}
+	tag := make([]byte, 3)
+	if _, err := r.ReadAt(tag, size-128); err != nil {
+		return false
+	}
+	return bytes.Equal(tag, []byte("TAG"))
+}
+
+// findFrame looks for the first valid frame header that is followed by another one, to avoid false syncs.
+func findFrame(buf []byte) (int, frameHeader, bool) {
+	for i := 0; i+4 <= len(buf); i++ {
+		if buf[i] != 0xFF || buf[i+1]&0xE0 != 0xE0 {
+			continue
+		}
+		header, ok := parseFrameHeader(buf[i : i+4])
+		if !ok {
+			continue
+		}
+		next := i + header.frameLength()
+		if next+4 <= len(buf) {
+			if _, ok := parseFrameHeader(buf[next : next+4]); !ok {
+				continue
+			}
+		}
+		return i, header, true
+	}
+	return 0, frameHeader{}, false
+}
+
+func parseFrameHeader(b []byte) (frameHeader, bool) {
+	var h frameHeader
+	if b[0] != 0xFF || b[1]&0xE0 != 0xE0 {
+		return h, false
+	}
+	switch (b[1] >> 3) & 0x03 {
+	case 0:
+		h.mpegVersion = 25
+	case 2:
+		h.mpegVersion = 2
+	case 3:
+		h.mpegVersion = 1
+	default:
+		return h, false
+	}
+	layerBits := (b[1] >> 1) & 0x03
+	if layerBits == 0 {
+		return h, false
+	}
+	h.layer = 4 - int(layerBits)
+
+	bitrateIndex := b[2] >> 4
+	sampleRateIndex := (b[2] >> 2) & 0x03
+	if bitrateIndex == 0 || bitrateIndex == 0x0F || sampleRateIndex == 0x03 {
+		// free format bitrates are not supported
+		return h, false
+	}
+	table := 1
+	if h.mpegVersion == 1 {
+		table = 0
+	}
+	h.bitrate = bitrateTable[table][h.layer-1][bitrateIndex] * 1000
+	h.sampleRate = sampleRateTable[h.mpegVersion][sampleRateIndex]
+	h.padding = int((b[2] >> 1) & 0x01)
+	h.mono = b[3]>>6 == 0x03
+
+	switch {
+	case h.layer == 1:
+		h.samplesPerFrame = 384
+	case h.layer == 3 && h.mpegVersion != 1:
+		h.samplesPerFrame = 576
+	default:
+		h.samplesPerFrame = 1152
+	}
+	return h, true
+}
+
+func (h frameHeader) frameLength() int {
+	if h.layer == 1 {
+		return (12*h.bitrate/h.sampleRate + h.padding) * 4
+	}
+	return h.samplesPerFrame/8*h.bitrate/h.sampleRate + h.padding
+}
+
+// frameCount reads the total number of frames from a Xing/Info or VBRI header in the first frame.
+// Encoders write "Info" instead of "Xing" for CBR files, the frame count is exact either way.
+func frameCount(frame []byte, h frameHeader) (frames uint32, vbr bool, ok bool) {
+	sideInfo := 17
+	switch {
+	case h.mpegVersion == 1 && !h.mono:
+		sideInfo = 32
+	case h.mpegVersion != 1 && h.mono:
+		sideInfo = 9
+	}
+
+	xing := 4 + sideInfo
+	if len(frame) >= xing+12 {
+		tag := string(frame[xing : xing+4])
+		if tag == "Xing" || tag == "Info" {
+			flags := binary.BigEndian.Uint32(frame[xing+4 : xing+8])
+			if flags&0x01 == 0 {
+				return 0, false, false
+			}
+			return binary.BigEndian.Uint32(frame[xing+8 : xing+12]), tag == "Xing", true
+		}
+	}
+
+	// The VBRI header is always located 32 bytes after the frame header
+	const vbri = 4 + 32
+	if len(frame) >= vbri+18 && string(frame[vbri:vbri+4]) == "VBRI" {
+		return binary.BigEndian.Uint32(frame[vbri+14 : vbri+18]), true, true
+	}
+	return 0, false, false
+}
+
+func syncsafe(b []byte) uint32 {
+	return uint32(b[0]&0x7F)<<21 | uint32(b[1]&0x7F)<<14 | uint32(b[2]&0x7F)<<7 | uint32(b[3]&0x7F)
+}
@@ -0,0 +1,156 @@
+package music
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+)
+
+var (
+	// MPEG 1 layer 3, 128 kbit/s, 44.1 kHz, frames are 417 bytes long
+	stereoHeader = []byte{0xFF, 0xFB, 0x90, 0x00}
+	monoHeader   = []byte{0xFF, 0xFB, 0x90, 0xC0}
+)
+
+const frameSize = 417
+
+// frames returns n silent frames starting with header.
+func frames(header []byte, n int) []byte {
+	var b []byte
+	for range n {
+		frame := make([]byte, frameSize)
+		copy(frame, header)
+		b = append(b, frame...)
+	}
+	return b
+}
+
+// infoFrame returns a frame carrying a Xing/Info or VBRI header with the total number of frames at offset.
+func infoFrame(header []byte, offset int, tag string, flags, total uint32) []byte {
+	frame := frames(header, 1)
+	copy(frame[offset:], tag)
+	if tag == "VBRI" {
+		binary.BigEndian.PutUint32(frame[offset+14:], total)
+		return frame
+	}
+	binary.BigEndian.PutUint32(frame[offset+4:], flags)
+	binary.BigEndian.PutUint32(frame[offset+8:], total)
+	return frame
+}
+
+// id3v2Tag returns an ID3v2.3 tag without frames and size bytes of padding.
+func id3v2Tag(size int) []byte {
+	tag := []byte{'I', 'D', '3', 3, 0, 0, byte(size >> 21 & 0x7F), byte(size >> 14 & 0x7F), byte(size >> 7 & 0x7F), byte(size & 0x7F)}
+	return append(tag, make([]byte, size)...)
+}
+
+func TestFindFrame(t *testing.T) {
+	falseSync := append(slices.Clone(stereoHeader), make([]byte, 500)...)
+	tests := []struct {
+		name       string
+		buf        []byte
+		wantOffset int
+		wantOK     bool
+	}{
+		{name: "at the start", buf: frames(stereoHeader, 2), wantOffset: 0, wantOK: true},
+		{name: "after padding", buf: append(make([]byte, 10), frames(stereoHeader, 2)...), wantOffset: 10, wantOK: true},
+		{name: "false sync", buf: append(falseSync, frames(stereoHeader, 2)...), wantOffset: len(falseSync), wantOK: true},
+		{name: "last frame of the buffer", buf: frames(stereoHeader, 1), wantOffset: 0, wantOK: true},
+		{name: "reserved bitrate", buf: frames([]byte{0xFF, 0xFB, 0xF0, 0x00}, 2)},
+		{name: "reserved layer", buf: frames([]byte{0xFF, 0xF9, 0x90, 0x00}, 2)},
+		{name: "silence", buf: make([]byte, 2000)},
+		{name: "empty", buf: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			offset, header, ok := findFrame(tt.buf)
+			if ok != tt.wantOK || offset != tt.wantOffset {
+				t.Fatalf("findFrame() = %d, %v, want %d, %v", offset, ok, tt.wantOffset, tt.wantOK)
+			}
+			if ok && (header.bitrate != 128000 || header.sampleRate != 44100 || header.frameLength() != frameSize) {
+				t.Errorf("findFrame() header = %+v, want 128 kbit/s at 44.1 kHz", header)
+			}
+		})
+	}
+}
+
+func TestFrameCount(t *testing.T) {
+	tests := []struct {
+		name       string
+		frame      []byte
+		wantFrames uint32
+		wantVBR    bool
+		wantOK     bool
+	}{
+		{name: "Xing", frame: infoFrame(stereoHeader, 36, "Xing", 0x0F, 1000), wantFrames: 1000, wantVBR: true, wantOK: true},
+		{name: "Info", frame: infoFrame(stereoHeader, 36, "Info", 0x01, 1000), wantFrames: 1000, wantOK: true},
+		{name: "Xing of a mono file", frame: infoFrame(monoHeader, 21, "Xing", 0x01, 500), wantFrames: 500, wantVBR: true, wantOK: true},
+		{name: "Xing without frame count", frame: infoFrame(stereoHeader, 36, "Xing", 0x0E, 1000)},
+		{name: "Xing at the stereo offset of a mono file", frame: infoFrame(monoHeader, 36, "Xing", 0x01, 500)},
+		{name: "VBRI", frame: infoFrame(stereoHeader, 36, "VBRI", 0, 2000), wantFrames: 2000, wantVBR: true, wantOK: true},
+		{name: "plain frame", frame: frames(stereoHeader, 1)},
+		{name: "truncated frame", frame: infoFrame(stereoHeader, 36, "Xing", 0x01, 1000)[:40]},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header, ok := parseFrameHeader(tt.frame)
+			if !ok {
+				t.Fatal("invalid frame header")
+			}
+			frames, vbr, ok := frameCount(tt.frame, header)
+			if frames != tt.wantFrames || vbr != tt.wantVBR || ok != tt.wantOK {
+				t.Errorf("frameCount() = %d, %v, %v, want %d, %v, %v", frames, vbr, ok, tt.wantFrames, tt.wantVBR, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestAnalyzeMP3(t *testing.T) {
+	id3v1 := append([]byte("TAG"), make([]byte, 125)...)
+	// 100 frames of 1152 samples at 44.1 kHz
+	seconds := 100 * 1152 / 44100.0
+	vbrDuration := time.Duration(seconds * float64(time.Second))
+	tests := []struct {
+		name    string
+		file    []byte
+		want    mp3Info
+		wantErr error
+	}{
+		{
+			name: "CBR",
+			file: frames(stereoHeader, 10),
+			want: mp3Info{bitrate: 128000, duration: 260625 * time.Microsecond},
+		},
+		{
+			name: "CBR with ID3 tags",
+			file: slices.Concat(id3v2Tag(100), frames(stereoHeader, 10), id3v1),
+			want: mp3Info{audioStart: 110, bitrate: 128000, duration: 260625 * time.Microsecond},
+		},
+		{
+			name: "VBR",
+			file: slices.Concat(infoFrame(stereoHeader, 36, "Xing", 0x01, 100), frames(stereoHeader, 99)),
+			want: mp3Info{bitrate: int(100 * frameSize * 8 / seconds), duration: vbrDuration, vbr: true},
+		},
+		{
+			name: "CBR with Info header",
+			file: slices.Concat(infoFrame(stereoHeader, 36, "Info", 0x01, 100), frames(stereoHeader, 99)),
+			want: mp3Info{bitrate: int(100 * frameSize * 8 / seconds), duration: vbrDuration},
+		},
+		{name: "no frames", file: make([]byte, 1000), wantErr: errNoFrame},
+		{name: "empty file", file: nil, wantErr: errNoFrame},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info, err := analyzeMP3(bytes.NewReader(tt.file), int64(len(tt.file)))
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("analyzeMP3() error = %v, want %v", err, tt.wantErr)
+			}
+			if info != tt.want {
+				t.Errorf("analyzeMP3() = %+v, want %+v", info, tt.want)
+			}
+		})
+	}
+}
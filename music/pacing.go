@@ -0,0 +1,69 @@
+package music
+
+import (
+	"context"
+	"time"
+)
+
+const (
+	// DefaultInitialBurst is how much audio is sent unthrottled so the player can fill its buffer.
+	DefaultInitialBurst = 10 * time.Second
+	// fallbackBitrate is used when the frame headers of a file cannot be read.
+	fallbackBitrate = 320_000
+)
+
+var initialBurst = DefaultInitialBurst
+
+// SetInitialBurst configures the amount of audio sent at full speed before pacing kicks in.
+func SetInitialBurst(d time.Duration) {
+	initialBurst = d
+}
+
+// pacer throttles a stream to the bitrate of the track. It keeps an absolute schedule, so a slow
+// write is caught up afterwards instead of accumulating delay.
+type pacer struct {
+	bytesPerSecond float64
+	burstBytes     int64
+	started        time.Time
+	sent           int64
+}
+
+// newPacer returns nil when pacing is disabled, a nil pacer never waits.
+func newPacer(bitrate int, enabled bool) *pacer {
+	if !enabled {
+		return nil
+	}
+	if bitrate <= 0 {
+		bitrate = fallbackBitrate
+	}
+	bytesPerSecond := float64(bitrate) / 8
+	return &pacer{
+		bytesPerSecond: bytesPerSecond,
+		burstBytes:     int64(bytesPerSecond * initialBurst.Seconds()),
+		started:        time.Now(),
+	}
+}
+
+// wait records n written bytes and blocks until the schedule allows the next write.
+func (p *pacer) wait(ctx context.Context, n int) error {
+	if p == nil {
+		return nil
+	}
+	p.sent += int64(n)
+	if p.sent <= p.burstBytes {
+		return nil
+	}
+	due := p.started.Add(time.Duration(float64(p.sent-p.burstBytes) / p.bytesPerSecond * float64(time.Second)))
+	delay := time.Until(due)
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,405 @@
+package music
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"homeApplications/middleware"
+	"homeApplications/models"
+	musicModels "homeApplications/music/models"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+var (
+	errPlaylistNotFound  = middleware.NewError(http.StatusNotFound, "playlist_not_found", "Playlist not found")
+	errPlaylistForbidden = middleware.ErrForbidden
+)
+
+// Playlists handles /playlists: listing the visible playlists and creating new ones.
+func Playlists(w http.ResponseWriter, r *http.Request) {
+	middleware.EnableCors(&w)
+	appUser, err := middleware.CheckAuthorization(r, models.PermMusicListen)
+	if err != nil {
+		middleware.WriteError(w, r, err)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		listPlaylists(w, r, *appUser)
+	case http.MethodPost:
+		createPlaylist(w, r, *appUser)
+	default:
+		middleware.WriteError(w, r, middleware.ErrMethodNotAllowed)
+	}
+}
+
+// Playlist handles /playlists/{id}: fetching with tracks, renaming and deleting.
+func Playlist(w http.ResponseWriter, r *http.Request) {
+	middleware.EnableCors(&w)
+	appUser, err := middleware.CheckAuthorization(r, models.PermMusicListen)
+	if err != nil {
+		middleware.WriteError(w, r, err)
+		return
+	}
+	playlistID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		middleware.WriteError(w, r, middleware.NewError(http.StatusBadRequest, "invalid_playlist_id", "Invalid playlist ID"))
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		getPlaylist(w, r, *appUser, playlistID)
+	case http.MethodPatch:
+		renamePlaylist(w, r, *appUser, playlistID)
+	case http.MethodDelete:
+		deletePlaylist(w, r, *appUser, playlistID)
+	default:
+		middleware.WriteError(w, r, middleware.ErrMethodNotAllowed)
+	}
+}
+
+// PlaylistTracks handles /playlists/{id}/tracks and /playlists/{id}/tracks/{trackId}.
+func PlaylistTracks(w http.ResponseWriter, r *http.Request) {
+	middleware.EnableCors(&w)
+	appUser, err := middleware.CheckAuthorization(r, models.PermMusicListen)
+	if err != nil {
+		middleware.WriteError(w, r, err)
+		return
+	}
+	playlistID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		middleware.WriteError(w, r, middleware.NewError(http.StatusBadRequest, "invalid_playlist_id", "Invalid playlist ID"))
+		return
+	}
+	if err := checkPlaylistAccess(r.Context(), *appUser, playlistID, true); err != nil {
+		handlePlaylistError(w, r, err)
+		return
+	}
+
+	switch {
+	case r.Method == http.MethodPost && r.PathValue("trackId") == "":
+		addTrack(w, r, playlistID)
+	case r.Method == http.MethodPut && r.PathValue("trackId") == "":
+		reorderTracks(w, r, playlistID)
+	case r.Method == http.MethodDelete && r.PathValue("trackId") != "":
+		trackID, err := strconv.Atoi(r.PathValue("trackId"))
+		if err != nil {
+			middleware.WriteError(w, r, middleware.NewError(http.StatusBadRequest, "invalid_track_id", "Invalid track ID"))
+			return
+		}
+		removeTrack(w, r, playlistID, trackID)
+	default:
+		middleware.WriteError(w, r, middleware.ErrMethodNotAllowed)
+	}
+}
+
+func listPlaylists(w http.ResponseWriter, r *http.Request, appUser models.AppUser) {
+	// Curators see every playlist of the household, everybody else their own and the shared ones
+	condition, household := middleware.OwnHousehold(appUser).Where("household_id", 3)
+	rows, err := dbPool.Query(r.Context(), `SELECT id, name, owner_user_id FROM playlists
+		WHERE `+condition+` AND (owner_user_id IS NULL OR owner_user_id=$1 OR $2)
+		ORDER BY owner_user_id NULLS FIRST, name`, appUser.ID, middleware.HasPermission(r.Context(), appUser, models.PermPlaylistsCurate), household)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to execute query", "error", err)
+		middleware.WriteError(w, r, middleware.ErrInternal)
+		return
+	}
+	defer rows.Close()
+
+	playlists := []musicModels.Playlist{}
+	for rows.Next() {
+		var playlist musicModels.Playlist
+		if err := rows.Scan(&playlist.ID, &playlist.Name, &playlist.OwnerUserID); err != nil {
+			slog.ErrorContext(r.Context(), "Failed to scan row", "error", err)
+			middleware.WriteError(w, r, middleware.ErrInternal)
+			return
+		}
+		playlist.Shared = playlist.OwnerUserID == nil
+		playlists = append(playlists, playlist)
+	}
+	json.NewEncoder(w).Encode(playlists)
+}
+
+func createPlaylist(w http.ResponseWriter, r *http.Request, appUser models.AppUser) {
+	var req musicModels.PlaylistRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || strings.TrimSpace(req.Name) == "" {
+		middleware.WriteError(w, r, middleware.ErrInvalidPayload)
+		return
+	}
+	required := models.PermPlaylistsManage
+	if req.Shared {
+		required = models.PermPlaylistsCurate
+	}
+	if !middleware.HasPermission(r.Context(), appUser, required) {
+		middleware.WriteError(w, r, middleware.ErrForbidden)
+		return
+	}
+
+	playlist := musicModels.Playlist{Name: strings.TrimSpace(req.Name), Shared: req.Shared}
+	if !req.Shared {
+		playlist.OwnerUserID = &appUser.ID
+	}
+	err := dbPool.QueryRow(r.Context(), "INSERT INTO playlists (name, owner_user_id, household_id) VALUES ($1, $2, $3) RETURNING id",
+		playlist.Name, playlist.OwnerUserID, appUser.HouseholdID).Scan(&playlist.ID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to execute query", "error", err)
+		middleware.WriteError(w, r, middleware.ErrInternal)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(playlist)
+}
+
+func getPlaylist(w http.ResponseWriter, r *http.Request, appUser models.AppUser, playlistID int) {
+	if err := checkPlaylistAccess(r.Context(), appUser, playlistID, false); err != nil {
+		handlePlaylistError(w, r, err)
+		return
+	}
+
+	var playlist musicModels.Playlist
+	err := dbPool.QueryRow(r.Context(), "SELECT id, name, owner_user_id FROM playlists WHERE id=$1", playlistID).
+		Scan(&playlist.ID, &playlist.Name, &playlist.OwnerUserID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to execute query", "error", err)
+		middleware.WriteError(w, r, middleware.ErrInternal)
+		return
+	}
+	playlist.Shared = playlist.OwnerUserID == nil
+
+	rows, err := dbPool.Query(r.Context(), `SELECT t.id, t.position, s.id, s.title, s.file_name, s.artist, s.album, s.track_number, s.duration_ms,
+			EXISTS (SELECT 1 FROM song_covers c WHERE c.song_id = s.id)
+		FROM playlist_tracks t JOIN songs s ON s.id = t.song_id
+		WHERE t.playlist_id=$1 ORDER BY t.position`, playlistID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to execute query", "error", err)
+		middleware.WriteError(w, r, middleware.ErrInternal)
+		return
+	}
+	defer rows.Close()
+
+	playlist.Tracks = []musicModels.PlaylistTrack{}
+	for rows.Next() {
+		var track musicModels.PlaylistTrack
+		song := &track.Song
+		if err := rows.Scan(&track.ID, &track.Position, &song.ID, &song.Title, &song.FileName, &song.Artist, &song.Album,
+			&song.TrackNumber, &song.DurationMs, &song.HasCover); err != nil {
+			slog.ErrorContext(r.Context(), "Failed to scan row", "error", err)
+			middleware.WriteError(w, r, middleware.ErrInternal)
+			return
+		}
+		playlist.Tracks = append(playlist.Tracks, track)
+	}
+	json.NewEncoder(w).Encode(playlist)
+}
+
+func renamePlaylist(w http.ResponseWriter, r *http.Request, appUser models.AppUser, playlistID int) {
+	if err := checkPlaylistAccess(r.Context(), appUser, playlistID, true); err != nil {
+		handlePlaylistError(w, r, err)
+		return
+	}
+	var req musicModels.PlaylistRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || strings.TrimSpace(req.Name) == "" {
+		middleware.WriteError(w, r, middleware.ErrInvalidPayload)
+		return
+	}
+	if _, err := dbPool.Exec(r.Context(), "UPDATE playlists SET name=$1 WHERE id=$2", strings.TrimSpace(req.Name), playlistID); err != nil {
+		slog.ErrorContext(r.Context(), "Failed to execute query", "error", err)
+		middleware.WriteError(w, r, middleware.ErrInternal)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]string{"status": "success"})
+}
+
+func deletePlaylist(w http.ResponseWriter, r *http.Request, appUser models.AppUser, playlistID int) {
+	if err := checkPlaylistAccess(r.Context(), appUser, playlistID, true); err != nil {
+		handlePlaylistError(w, r, err)
+		return
+	}
+	if _, err := dbPool.Exec(r.Context(), "DELETE FROM playlists WHERE id=$1", playlistID); err != nil {
+		slog.ErrorContext(r.Context(), "Failed to execute query", "error", err)
+		middleware.WriteError(w, r, middleware.ErrInternal)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// addTrack inserts a song at the requested position, the following tracks move down by one.
+func addTrack(w http.ResponseWriter, r *http.Request, playlistID int) {
+	var req musicModels.AddTrackRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.SongID == 0 {
+		middleware.WriteError(w, r, middleware.ErrInvalidPayload)
+		return
+	}
+
+	tx, err := dbPool.Begin(r.Context())
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to begin transaction", "error", err)
+		middleware.WriteError(w, r, middleware.ErrInternal)
+		return
+	}
+	defer tx.Rollback(r.Context())
+	if err := lockPlaylist(r.Context(), tx, playlistID); err != nil {
+		handlePlaylistError(w, r, err)
+		return
+	}
+
+	var count int
+	if err := tx.QueryRow(r.Context(), "SELECT COUNT(*) FROM playlist_tracks WHERE playlist_id=$1", playlistID).Scan(&count); err != nil {
+		slog.ErrorContext(r.Context(), "Failed to execute query", "error", err)
+		middleware.WriteError(w, r, middleware.ErrInternal)
+		return
+	}
+	position := count
+	if req.Position != nil && *req.Position >= 0 && *req.Position < count {
+		position = *req.Position
+	}
+
+	// Positions are rewritten densely, so gaps left by removed songs are closed as well
+	if _, err := tx.Exec(r.Context(), `UPDATE playlist_tracks t SET position = o.rn + CASE WHEN o.rn >= $2 THEN 1 ELSE 0 END
+		FROM (SELECT id, ROW_NUMBER() OVER (ORDER BY position) - 1 AS rn FROM playlist_tracks WHERE playlist_id=$1) o
+		WHERE t.id = o.id`, playlistID, position); err != nil {
+		slog.ErrorContext(r.Context(), "Failed to execute query", "error", err)
+		middleware.WriteError(w, r, middleware.ErrInternal)
+		return
+	}
+
+	var track musicModels.PlaylistTrack
+	err = tx.QueryRow(r.Context(), "INSERT INTO playlist_tracks (playlist_id, song_id, position) VALUES ($1, $2, $3) RETURNING id, position",
+		playlistID, req.SongID, position).Scan(&track.ID, &track.Position)
+	if err != nil {
+		if pgErr, ok := errors.AsType[*pgconn.PgError](err); ok && pgErr.Code == "23503" { // 23503 is the PostgreSQL error code for foreign key violation
+			middleware.WriteError(w, r, middleware.NewError(http.StatusNotFound, "song_not_found", "Song not found"))
+			return
+		}
+		slog.ErrorContext(r.Context(), "Failed to execute query", "error", err)
+		middleware.WriteError(w, r, middleware.ErrInternal)
+		return
+	}
+	if err := tx.Commit(r.Context()); err != nil {
+		slog.ErrorContext(r.Context(), "Failed to commit transaction", "error", err)
+		middleware.WriteError(w, r, middleware.ErrInternal)
+		return
+	}
+	track.Song.ID = req.SongID
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(track)
+}
+
+// reorderTracks expects the IDs of all tracks of the playlist in their new order.
+func reorderTracks(w http.ResponseWriter, r *http.Request, playlistID int) {
+	var req musicModels.ReorderRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		middleware.WriteError(w, r, middleware.ErrInvalidPayload)
+		return
+	}
+
+	tx, err := dbPool.Begin(r.Context())
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to begin transaction", "error", err)
+		middleware.WriteError(w, r, middleware.ErrInternal)
+		return
+	}
+	defer tx.Rollback(r.Context())
+	if err := lockPlaylist(r.Context(), tx, playlistID); err != nil {
+		handlePlaylistError(w, r, err)
+		return
+	}
+
+	var matching, total int
+	err = tx.QueryRow(r.Context(), "SELECT COUNT(*) FILTER (WHERE id = ANY($2)), COUNT(*) FROM playlist_tracks WHERE playlist_id=$1",
+		playlistID, req.TrackIDs).Scan(&matching, &total)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to execute query", "error", err)
+		middleware.WriteError(w, r, middleware.ErrInternal)
+		return
+	}
+	if matching != total || len(req.TrackIDs) != total {
+		middleware.WriteError(w, r, middleware.NewError(http.StatusBadRequest, "invalid_track_order", "trackIds must contain every track of the playlist exactly once"))
+		return
+	}
+
+	_, err = tx.Exec(r.Context(), `UPDATE playlist_tracks t SET position = o.ord - 1
+		FROM UNNEST($2::int[]) WITH ORDINALITY AS o(id, ord)
+		WHERE t.id = o.id AND t.playlist_id=$1`, playlistID, req.TrackIDs)
+	if err == nil {
+		err = tx.Commit(r.Context())
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to reorder playlist", "error", err)
+		middleware.WriteError(w, r, middleware.ErrInternal)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]string{"status": "success"})
+}
+
+func removeTrack(w http.ResponseWriter, r *http.Request, playlistID, trackID int) {
+	tag, err := dbPool.Exec(r.Context(), "DELETE FROM playlist_tracks WHERE id=$1 AND playlist_id=$2", trackID, playlistID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to execute query", "error", err)
+		middleware.WriteError(w, r, middleware.ErrInternal)
+		return
+	}
+	if tag.RowsAffected() == 0 {
+		middleware.WriteError(w, r, middleware.NewError(http.StatusNotFound, "track_not_found", "Track not found"))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// checkPlaylistAccess applies the access rules: everybody may listen to shared playlists and manage their own,
+// curators manage shared playlists and may also manage every other playlist. Playlists of other households do not exist for the user.
+func checkPlaylistAccess(ctx context.Context, appUser models.AppUser, playlistID int, edit bool) error {
+	var ownerUserID *int
+	condition, household := middleware.OwnHousehold(appUser).Where("household_id", 2)
+	err := dbPool.QueryRow(ctx, "SELECT owner_user_id FROM playlists WHERE id=$1 AND "+condition, playlistID, household).Scan(&ownerUserID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return errPlaylistNotFound
+		}
+		return err
+	}
+	if middleware.HasPermission(ctx, appUser, models.PermPlaylistsCurate) {
+		return nil
+	}
+	if ownerUserID == nil {
+		if edit {
+			return errPlaylistForbidden
+		}
+		return nil
+	}
+	if *ownerUserID != appUser.ID {
+		// Do not reveal other users' playlists
+		return errPlaylistNotFound
+	}
+	if edit && !middleware.HasPermission(ctx, appUser, models.PermPlaylistsManage) {
+		return errPlaylistForbidden
+	}
+	return nil
+}
+
+// lockPlaylist serializes the changes to the tracks of a playlist until tx ends, so concurrent requests do not
+// compute the same positions.
+func lockPlaylist(ctx context.Context, tx pgx.Tx, playlistID int) error {
+	var id int
+	err := tx.QueryRow(ctx, "SELECT id FROM playlists WHERE id=$1 FOR UPDATE", playlistID).Scan(&id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return errPlaylistNotFound
+	}
+	return err
+}
+
+func handlePlaylistError(w http.ResponseWriter, r *http.Request, err error) {
+	if !errors.Is(err, errPlaylistNotFound) && !errors.Is(err, errPlaylistForbidden) {
+		slog.ErrorContext(r.Context(), "Failed to check playlist access", "error", err)
+	}
+	middleware.WriteError(w, r, err)
+}
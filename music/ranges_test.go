@@ -0,0 +1,112 @@
+package music
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestParseRange(t *testing.T) {
+	tests := []struct {
+		name    string
+		header  string
+		size    int64
+		want    byteRange
+		wantOK  bool
+		wantErr bool
+	}{
+		{name: "start and end", header: "bytes=0-99", size: 1000, want: byteRange{0, 99}, wantOK: true},
+		{name: "open end", header: "bytes=500-", size: 1000, want: byteRange{500, 999}, wantOK: true},
+		{name: "end beyond size", header: "bytes=900-2000", size: 1000, want: byteRange{900, 999}, wantOK: true},
+		{name: "single byte", header: "bytes=999-999", size: 1000, want: byteRange{999, 999}, wantOK: true},
+		{name: "suffix", header: "bytes=-100", size: 1000, want: byteRange{900, 999}, wantOK: true},
+		{name: "suffix larger than file", header: "bytes=-5000", size: 1000, want: byteRange{0, 999}, wantOK: true},
+		{name: "surrounding spaces", header: "bytes= 10-20 ", size: 1000, want: byteRange{10, 20}, wantOK: true},
+		{name: "other unit", header: "items=0-1", size: 1000},
+		{name: "multiple ranges", header: "bytes=0-1,5-6", size: 1000},
+		{name: "start beyond size", header: "bytes=1000-", size: 1000, wantErr: true},
+		{name: "end before start", header: "bytes=20-10", size: 1000, wantErr: true},
+		{name: "empty range", header: "bytes=-", size: 1000, wantErr: true},
+		{name: "zero suffix", header: "bytes=-0", size: 1000, wantErr: true},
+		{name: "suffix of empty file", header: "bytes=-10", size: 0, wantErr: true},
+		{name: "no dash", header: "bytes=10", size: 1000, wantErr: true},
+		{name: "not a number", header: "bytes=a-b", size: 1000, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok, err := parseRange(tt.header, tt.size)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseRange(%q, %d) error = %v, want error %v", tt.header, tt.size, err, tt.wantErr)
+			}
+			if ok != tt.wantOK || got != tt.want {
+				t.Errorf("parseRange(%q, %d) = %v, %v, want %v, %v", tt.header, tt.size, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestIfRangeMatches(t *testing.T) {
+	modTime := time.Date(2024, 5, 1, 12, 30, 15, 500, time.UTC)
+	etag := `"3e8-17cb"`
+	tests := []struct {
+		name    string
+		ifRange string
+		want    bool
+	}{
+		{name: "no header", want: true},
+		{name: "same etag", ifRange: etag, want: true},
+		{name: "other etag", ifRange: `"other"`},
+		{name: "weak etag", ifRange: "W/" + etag},
+		{name: "same date", ifRange: modTime.Format(http.TimeFormat), want: true},
+		{name: "earlier date", ifRange: modTime.Add(-time.Second).Format(http.TimeFormat)},
+		{name: "later date", ifRange: modTime.Add(time.Second).Format(http.TimeFormat)},
+		{name: "invalid date", ifRange: "yesterday"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/audio/song", nil)
+			if tt.ifRange != "" {
+				r.Header.Set("If-Range", tt.ifRange)
+			}
+			if got := ifRangeMatches(r, etag, modTime); got != tt.want {
+				t.Errorf("ifRangeMatches(%q) = %v, want %v", tt.ifRange, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNotModified(t *testing.T) {
+	modTime := time.Date(2024, 5, 1, 12, 30, 15, 500, time.UTC)
+	etag := `"3e8-17cb"`
+	tests := []struct {
+		name    string
+		headers map[string]string
+		want    bool
+	}{
+		{name: "no headers"},
+		{name: "matching etag", headers: map[string]string{"If-None-Match": etag}, want: true},
+		{name: "weak matching etag", headers: map[string]string{"If-None-Match": "W/" + etag}, want: true},
+		{name: "one of several etags", headers: map[string]string{"If-None-Match": `"a", ` + etag}, want: true},
+		{name: "any etag", headers: map[string]string{"If-None-Match": "*"}, want: true},
+		{name: "other etag", headers: map[string]string{"If-None-Match": `"a"`}},
+		{
+			name:    "etag wins over date",
+			headers: map[string]string{"If-None-Match": `"a"`, "If-Modified-Since": modTime.Format(http.TimeFormat)},
+		},
+		{name: "not modified since", headers: map[string]string{"If-Modified-Since": modTime.Format(http.TimeFormat)}, want: true},
+		{name: "modified since", headers: map[string]string{"If-Modified-Since": modTime.Add(-time.Second).Format(http.TimeFormat)}},
+		{name: "invalid date", headers: map[string]string{"If-Modified-Since": "yesterday"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/audio/song", nil)
+			for key, value := range tt.headers {
+				r.Header.Set(key, value)
+			}
+			if got := notModified(r, etag, modTime); got != tt.want {
+				t.Errorf("notModified() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,60 @@
+package music
+
+import (
+	"crypto/hmac"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+
+	"homeApplications/middleware"
+)
+
+// StreamURLTTL is how long a minted /audio/ URL stays valid.
+const StreamURLTTL = 30 * time.Minute
+
+// signStreamURL returns the /audio/ path for the song including user, device, expiry and signature
+// query parameters. The signature binds all of them to the song so none can be swapped.
+// deviceID is empty for sessions that are not bound to a device.
+func signStreamURL(title string, userID int, deviceID string, expiresAt time.Time) string {
+	expires := expiresAt.Unix()
+	query := url.Values{}
+	query.Set("uid", strconv.Itoa(userID))
+	if deviceID != "" {
+		query.Set("did", deviceID)
+	}
+	query.Set("exp", strconv.FormatInt(expires, 10))
+	query.Set("sig", streamSignature(title, userID, deviceID, expires))
+	return "/audio/" + url.PathEscape(title) + "?" + query.Encode()
+}
+
+// verifyStreamURL checks the signature query parameters of an /audio/ request and returns the device it was minted for.
+func verifyStreamURL(title string, query url.Values) (string, error) {
+	sig := query.Get("sig")
+	if sig == "" {
+		return "", errors.New("missing signature")
+	}
+	userID, err := strconv.Atoi(query.Get("uid"))
+	if err != nil {
+		return "", errors.New("invalid user")
+	}
+	expires, err := strconv.ParseInt(query.Get("exp"), 10, 64)
+	if err != nil {
+		return "", errors.New("invalid expiry")
+	}
+	deviceID := query.Get("did")
+	if !hmac.Equal([]byte(sig), []byte(streamSignature(title, userID, deviceID, expires))) {
+		return "", errors.New("invalid signature")
+	}
+	if time.Now().Unix() >= expires {
+		return "", errors.New("signature expired")
+	}
+	return deviceID, nil
+}
+
+func streamSignature(title string, userID int, deviceID string, expires int64) string {
+	payload := fmt.Sprintf("audio|%s|%d|%s|%d", title, userID, deviceID, expires)
+	return base64.RawURLEncoding.EncodeToString(middleware.Sign([]byte(payload)))
+}
@@ -0,0 +1,66 @@
+package music
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"homeApplications/middleware"
+)
+
+func TestVerifyStreamURL(t *testing.T) {
+	if err := middleware.SetTokenSecret("test secret"); err != nil {
+		t.Fatal(err)
+	}
+	future := time.Now().Add(StreamURLTTL)
+	tests := []struct {
+		name       string
+		title      string
+		deviceID   string
+		expiresAt  time.Time
+		change     func(url.Values)
+		verifyAs   string
+		wantDevice string
+		wantErr    bool
+	}{
+		{name: "valid", title: "Song", expiresAt: future},
+		{name: "valid with device", title: "Song", deviceID: "device", expiresAt: future, wantDevice: "device"},
+		{name: "title with spaces", title: "A Song & more", expiresAt: future},
+		{name: "other song", title: "Song", expiresAt: future, verifyAs: "Other", wantErr: true},
+		{name: "other user", title: "Song", expiresAt: future, change: func(q url.Values) { q.Set("uid", "2") }, wantErr: true},
+		{name: "other device", title: "Song", deviceID: "device", expiresAt: future, change: func(q url.Values) { q.Set("did", "other") }, wantErr: true},
+		{name: "device removed", title: "Song", deviceID: "device", expiresAt: future, change: func(q url.Values) { q.Del("did") }, wantErr: true},
+		{name: "device added", title: "Song", expiresAt: future, change: func(q url.Values) { q.Set("did", "device") }, wantErr: true},
+		{name: "longer expiry", title: "Song", expiresAt: future, change: func(q url.Values) { q.Set("exp", "99999999999") }, wantErr: true},
+		{name: "missing signature", title: "Song", expiresAt: future, change: func(q url.Values) { q.Del("sig") }, wantErr: true},
+		{name: "invalid user", title: "Song", expiresAt: future, change: func(q url.Values) { q.Set("uid", "x") }, wantErr: true},
+		{name: "invalid expiry", title: "Song", expiresAt: future, change: func(q url.Values) { q.Set("exp", "x") }, wantErr: true},
+		{name: "expired", title: "Song", expiresAt: time.Now().Add(-time.Second), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			signed, err := url.Parse(signStreamURL(tt.title, 1, tt.deviceID, tt.expiresAt))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, want := signed.Path, "/audio/"+tt.title; got != want {
+				t.Errorf("path = %q, want %q", got, want)
+			}
+			query := signed.Query()
+			if tt.change != nil {
+				tt.change(query)
+			}
+			title := tt.title
+			if tt.verifyAs != "" {
+				title = tt.verifyAs
+			}
+			deviceID, err := verifyStreamURL(title, query)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("verifyStreamURL() error = %v, want error %v", err, tt.wantErr)
+			}
+			if deviceID != tt.wantDevice {
+				t.Errorf("verifyStreamURL() device = %q, want %q", deviceID, tt.wantDevice)
+			}
+		})
+	}
+}
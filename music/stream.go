@@ -1,144 +1,276 @@
 package music
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"github.com/google/uuid"
+	"homeApplications/metrics"
 	"homeApplications/middleware"
+	"homeApplications/models"
 	musicModels "homeApplications/music/models"
 	"io"
-	"log"
+	"log/slog"
+	"mime"
 	"net/http"
 	"os"
 	"path/filepath"
 	"strings"
 	"time"
+
+	"github.com/jackc/pgx/v5"
 )
 
 const (
-	BUFFERSIZE = 16384
-	// DELAY should optimally be: track_duration * buffer_size / mp3_file_size
-	DELAY          = 150
-	MUSIC_DIR      = "music/"
-	FILE_EXTENSION = ".mp3"
+	DefaultBufferSize = 16384
+	DefaultMusicDir   = "music/"
+	FILE_EXTENSION    = ".mp3"
+)
+
+var (
+	musicDir   = DefaultMusicDir
+	bufferSize = DefaultBufferSize
 )
 
+var (
+	activeStreams = metrics.NewGauge("homeapp_audio_active_streams", "Audio streams currently being sent.")
+	streamedBytes = metrics.NewCounterVec("homeapp_audio_streamed_bytes_total", "Bytes of audio sent to clients.")
+)
+
+// SetLibrary configures the directory holding the mp3 files and how many bytes of a file are read per write.
+func SetLibrary(dir string, readBufferSize int) {
+	musicDir = dir
+	bufferSize = readBufferSize
+}
+
+// songPath returns the path of the file of a song. Its extension can be .mp3 in any case, so the file name is
+// looked up in the library. Songs that are not indexed yet and streams while the database is down use .mp3.
+func songPath(ctx context.Context, name string) string {
+	var diskName string
+	err := dbPool.QueryRow(ctx, "SELECT disk_file_name FROM songs WHERE file_name=$1", name).Scan(&diskName)
+	if err != nil {
+		if !errors.Is(err, pgx.ErrNoRows) {
+			slog.WarnContext(ctx, "Failed to look up the song file", "error", err)
+		}
+		diskName = name + FILE_EXTENSION
+	}
+	return filepath.Join(musicDir, filepath.Base(diskName))
+}
+
 // StreamMusic Idea and implementation proudly taken from https://github.com/Icelain/radio/blob/main/main.go
-// Currently not secured as the client uses flutter audioplayers and that one doesn't support headers when calling an
-// endpoint
+// The client uses flutter audioplayers, which doesn't support headers when calling an endpoint. Instead of an
+// Authorization header the request has to carry a signed URL minted by GetStreamURL.
 func StreamMusic(w http.ResponseWriter, r *http.Request) {
 	middleware.EnableCors(&w)
 
 	filename := strings.TrimPrefix(r.URL.Path, "/audio/")
 	if filename == "" {
-		log.Println("No file name provided")
-		http.Error(w, "No file specified", http.StatusBadRequest)
+		slog.InfoContext(r.Context(), "No file name provided")
+		middleware.WriteError(w, r, middleware.NewError(http.StatusBadRequest, "file_required", "No file specified"))
 		return
 	}
 
 	cleanName := filepath.Base(filepath.Clean(filename))
 	if cleanName != filename {
-		log.Println("File name is not valid")
-		http.Error(w, "Invalid file path", http.StatusBadRequest)
+		slog.InfoContext(r.Context(), "File name is not valid", "file", filename)
+		middleware.WriteError(w, r, middleware.NewError(http.StatusBadRequest, "invalid_file_path", "Invalid file path"))
 		return
 	}
-	nameWithExtension := cleanName + FILE_EXTENSION
-	fpath := filepath.Join(MUSIC_DIR, nameWithExtension)
+	deviceID, err := verifyStreamURL(cleanName, r.URL.Query())
+	if err == nil && deviceID != "" && !middleware.DeviceActive(r.Context(), deviceID) {
+		err = errors.New("device revoked")
+	}
+	if err != nil {
+		slog.InfoContext(r.Context(), "Rejected stream request", "file", cleanName, "error", err)
+		middleware.WriteError(w, r, middleware.NewError(http.StatusForbidden, "invalid_stream_url", "Invalid or expired stream URL"))
+		return
+	}
+	fpath := songPath(r.Context(), cleanName)
 
-	requestID := uuid.New().String()
-	log.Println(requestID, "Streaming file:", fpath)
+	slog.InfoContext(r.Context(), "Streaming file", "file", fpath)
 
 	if _, err := os.Stat(fpath); err != nil {
-		log.Println(requestID, "File does not exist:", err)
-		http.Error(w, "File not found", http.StatusNotFound)
+		slog.InfoContext(r.Context(), "File does not exist", "error", err)
+		middleware.WriteError(w, r, middleware.NewError(http.StatusNotFound, "file_not_found", "File not found"))
 		return
 	}
 	file, err := os.Open(fpath)
 	if err != nil {
-		log.Println(requestID, "Error opening file", err)
-		http.Error(w, "Invalid", http.StatusBadRequest)
+		slog.ErrorContext(r.Context(), "Error opening file", "error", err)
+		middleware.WriteError(w, r, middleware.ErrInternal)
 		return
 	}
 	defer func() {
 		if err := file.Close(); err != nil {
-			log.Println(requestID, "Error closing file:", err)
+			slog.ErrorContext(r.Context(), "Error closing file", "error", err)
 		}
 	}()
 
 	stat, err := file.Stat()
 	if err != nil {
-		log.Println(requestID, "Error getting file info:", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		slog.ErrorContext(r.Context(), "Error getting file info", "error", err)
+		middleware.WriteError(w, r, middleware.ErrInternal)
 		return
 	}
 
 	flusher, ok := w.(http.Flusher)
 	if !ok {
-		log.Println(requestID, "Could not create flusher")
-		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		slog.ErrorContext(r.Context(), "Could not create flusher")
+		middleware.WriteError(w, r, middleware.ErrInternal)
+		return
+	}
+
+	size := stat.Size()
+	etag := fileETag(stat)
+	w.Header().Set("Accept-Ranges", "bytes")
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Last-Modified", stat.ModTime().UTC().Format(http.TimeFormat))
+	if notModified(r, etag, stat.ModTime()) {
+		w.WriteHeader(http.StatusNotModified)
 		return
 	}
-	w.Header().Add("Content-Type", "audio/mpeg")
-	w.Header().Set("Content-Length", fmt.Sprintf("%d", stat.Size()))
+
+	// Serve the whole file unless a satisfiable range is requested and still matches the file
+	status := http.StatusOK
+	part := byteRange{start: 0, end: size - 1}
+	if rangeHeader := r.Header.Get("Range"); rangeHeader != "" && ifRangeMatches(r, etag, stat.ModTime()) {
+		br, ok, err := parseRange(rangeHeader, size)
+		if err != nil {
+			slog.InfoContext(r.Context(), "Invalid range", "range", rangeHeader)
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes */%d", size))
+			middleware.WriteError(w, r, middleware.NewError(http.StatusRequestedRangeNotSatisfiable, "range_not_satisfiable", "Requested range not satisfiable"))
+			return
+		}
+		if ok {
+			status = http.StatusPartialContent
+			part = br
+			w.Header().Set("Content-Range", br.contentRange(size))
+			slog.DebugContext(r.Context(), "Serving range", "range", br.contentRange(size))
+		}
+	}
+	if _, err := file.Seek(part.start, io.SeekStart); err != nil {
+		slog.ErrorContext(r.Context(), "Error seeking file", "error", err)
+		middleware.WriteError(w, r, middleware.ErrInternal)
+		return
+	}
+
+	// Download mode sends the file as fast as possible, streams are paced to the bitrate of the track
+	download := r.URL.Query().Get("download") == "true"
+	bitrate := 0
+	if !download {
+		if info, err := analyzeMP3(file, size); err != nil {
+			slog.WarnContext(r.Context(), "Could not read MP3 frame headers, using fallback bitrate", "error", err)
+		} else {
+			bitrate = info.bitrate
+		}
+	} else {
+		w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filepath.Base(fpath)}))
+	}
+
+	w.Header().Set("Content-Type", "audio/mpeg")
+	w.Header().Set("Content-Length", fmt.Sprintf("%d", max(part.length(), 0)))
 	w.Header().Add("Connection", "keep-alive")
+	w.WriteHeader(status)
+	if r.Method == http.MethodHead {
+		return
+	}
 
-	buffer := make([]byte, BUFFERSIZE)
-	ticker := time.NewTicker(time.Millisecond * DELAY)
-	defer ticker.Stop()
-	for range ticker.C {
-		n, err := file.Read(buffer)
+	activeStreams.Inc()
+	defer activeStreams.Dec()
+	reader := io.LimitReader(file, part.length())
+	buffer := make([]byte, bufferSize)
+	pace := newPacer(bitrate, !download)
+	for {
+		n, err := reader.Read(buffer)
 		if n > 0 {
-			if _, err := w.Write(buffer[:n]); err != nil {
-				log.Printf("%s, %s's connection to the audio stream has been closed\n", requestID, r.Host)
+			written, err := w.Write(buffer[:n])
+			streamedBytes.Add(float64(written))
+			if err != nil {
+				slog.InfoContext(r.Context(), "Client closed the audio stream")
 				return
 			}
 			flusher.Flush()
+			if err := pace.wait(r.Context(), n); err != nil {
+				slog.InfoContext(r.Context(), "Client closed the audio stream")
+				return
+			}
 		}
 		if err == io.EOF {
 			break
 		}
 		if err != nil {
-			log.Println(requestID, "Error reading file:", err)
+			slog.ErrorContext(r.Context(), "Error reading file", "error", err)
 			break
 		}
 	}
-	log.Println(requestID, "finished streaming")
+	slog.InfoContext(r.Context(), "Finished streaming")
+}
+
+// GetStreamURL mints a short-lived signed /audio/ URL for the authenticated user.
+func GetStreamURL(w http.ResponseWriter, r *http.Request) {
+	middleware.EnableCors(&w)
+	appUser, err := middleware.CheckAuthorization(r, models.PermMusicListen)
+	if err != nil {
+		slog.InfoContext(r.Context(), "Request rejected", "error", err)
+		middleware.WriteError(w, r, err)
+		return
+	}
+
+	title := strings.TrimPrefix(r.URL.Path, "/audioUrl/")
+	if title == "" || filepath.Base(filepath.Clean(title)) != title {
+		middleware.WriteError(w, r, middleware.NewError(http.StatusBadRequest, "invalid_file_path", "Invalid file path"))
+		return
+	}
+	if _, err := os.Stat(songPath(r.Context(), title)); err != nil {
+		middleware.WriteError(w, r, middleware.NewError(http.StatusNotFound, "file_not_found", "File not found"))
+		return
+	}
+
+	expiresAt := time.Now().Add(StreamURLTTL)
+	streamURL := musicModels.StreamURL{URL: signStreamURL(title, appUser.ID, appUser.DeviceID, expiresAt), ExpiresAt: expiresAt}
+	if err := json.NewEncoder(w).Encode(streamURL); err != nil {
+		slog.ErrorContext(r.Context(), "Failed to encode response", "error", err)
+	}
 }
 
 func FetchSongTitles(w http.ResponseWriter, r *http.Request) {
-	log.Println("fetch song titles")
 	middleware.EnableCors(&w)
-	_, err := middleware.AuthenticateUser(r)
+	_, err := middleware.CheckAuthorization(r, models.PermMusicListen)
 	if err != nil {
-		log.Println("auth error: " + err.Error() + " in FetchSongTitles")
-		middleware.HandleError(w, err)
+		slog.InfoContext(r.Context(), "Request rejected", "error", err)
+		middleware.WriteError(w, r, err)
 		return
 	}
 
-	entries, err := os.ReadDir(MUSIC_DIR)
+	rows, err := dbPool.Query(r.Context(), `SELECT s.id, s.title, s.file_name, s.artist, s.album, s.track_number, s.duration_ms, c.song_id IS NOT NULL
+		FROM songs s LEFT JOIN song_covers c ON c.song_id = s.id
+		ORDER BY s.artist, s.album, s.track_number, s.title`)
 	if err != nil {
-		log.Println("read dir error: " + err.Error() + " in FetchSongTitles")
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		slog.ErrorContext(r.Context(), "Failed to execute query", "error", err)
+		middleware.WriteError(w, r, middleware.ErrInternal)
 		return
 	}
+	defer rows.Close()
 
-	var directorySongs []musicModels.Song
-	for _, entry := range entries {
-		if !entry.IsDir() && strings.EqualFold(filepath.Ext(entry.Name()), FILE_EXTENSION) {
-			entryNameWithoutSuffix := strings.TrimSuffix(entry.Name(), FILE_EXTENSION)
-			directorySongs = append(directorySongs, musicModels.Song{Title: entryNameWithoutSuffix})
+	directorySongs := []musicModels.Song{}
+	for rows.Next() {
+		var song musicModels.Song
+		if err := rows.Scan(&song.ID, &song.Title, &song.FileName, &song.Artist, &song.Album, &song.TrackNumber, &song.DurationMs, &song.HasCover); err != nil {
+			slog.ErrorContext(r.Context(), "Failed to scan row", "error", err)
+			middleware.WriteError(w, r, middleware.ErrInternal)
+			return
 		}
+		directorySongs = append(directorySongs, song)
 	}
 
 	songs := musicModels.Songs{
 		Songs: directorySongs,
 	}
 
-	log.Println("successfully fetched song titles")
 	err = json.NewEncoder(w).Encode(songs)
 	if err != nil {
-		log.Println("json encoder error: " + err.Error() + " in FetchSongTitles")
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		slog.ErrorContext(r.Context(), "Failed to encode response", "error", err)
+		middleware.WriteError(w, r, middleware.ErrInternal)
 		return
 	}
 }
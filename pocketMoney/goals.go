@@ -0,0 +1,221 @@
+package pocketMoney
+
+import (
+	"encoding/json"
+	"log/slog"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"homeApplications/middleware"
+	"homeApplications/models"
+	pocketMoneyModels "homeApplications/pocketMoney/models"
+)
+
+// allowanceWindow is how far back allowances are averaged to project savings goals.
+const allowanceWindow = 12 * 7 * 24 * time.Hour
+
+// Goals handles /pocketMoney/{id}/goals: listing with progress and creating goals.
+// Users who may read all pocket money see every child's goals, but only the child manages them.
+func Goals(w http.ResponseWriter, r *http.Request) {
+	middleware.EnableCors(&w)
+	appUser, userID, ok := authorizeUserFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		listGoals(w, r, userID)
+	case http.MethodPost:
+		if appUser.ID != userID || !middleware.HasPermission(r.Context(), appUser, models.PermGoalsManage) {
+			middleware.WriteError(w, r, middleware.NewError(http.StatusForbidden, "goal_owner_only", "Goals can only be managed by their owner"))
+			return
+		}
+		createGoal(w, r, userID)
+	default:
+		middleware.WriteError(w, r, middleware.ErrMethodNotAllowed)
+	}
+}
+
+// Goal handles /pocketMoney/{id}/goals/{goalId}: updating and deleting a goal of the authenticated user.
+func Goal(w http.ResponseWriter, r *http.Request) {
+	middleware.EnableCors(&w)
+	appUser, userID, ok := authorizeUserFromPath(w, r)
+	if !ok {
+		return
+	}
+	if appUser.ID != userID || !middleware.HasPermission(r.Context(), appUser, models.PermGoalsManage) {
+		middleware.WriteError(w, r, middleware.NewError(http.StatusForbidden, "goal_owner_only", "Goals can only be managed by their owner"))
+		return
+	}
+	goalID, err := strconv.Atoi(r.PathValue("goalId"))
+	if err != nil {
+		middleware.WriteError(w, r, middleware.NewError(http.StatusBadRequest, "invalid_goal_id", "Invalid goal ID"))
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPut, http.MethodPatch:
+		req, ok := decodeGoalRequest(w, r)
+		if !ok {
+			return
+		}
+		tag, err := dbPool.Exec(r.Context(), "UPDATE savings_goals SET name=$1, target_amount=$2, deadline=$3, image_url=$4 WHERE id=$5 AND user_id=$6",
+			req.Name, req.TargetAmount, dateOrNil(req.Deadline), req.ImageURL, goalID, userID)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Failed to execute query", "error", err)
+			middleware.WriteError(w, r, middleware.ErrInternal)
+			return
+		}
+		if tag.RowsAffected() == 0 {
+			middleware.WriteError(w, r, middleware.NewError(http.StatusNotFound, "goal_not_found", "Goal not found"))
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"status": "success"})
+	case http.MethodDelete:
+		tag, err := dbPool.Exec(r.Context(), "DELETE FROM savings_goals WHERE id=$1 AND user_id=$2", goalID, userID)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Failed to execute query", "error", err)
+			middleware.WriteError(w, r, middleware.ErrInternal)
+			return
+		}
+		if tag.RowsAffected() == 0 {
+			middleware.WriteError(w, r, middleware.NewError(http.StatusNotFound, "goal_not_found", "Goal not found"))
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		middleware.WriteError(w, r, middleware.ErrMethodNotAllowed)
+	}
+}
+
+func listGoals(w http.ResponseWriter, r *http.Request, userID int) {
+	entries, err := loadEntries(r.Context(), userID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to load entries", "error", err)
+		middleware.WriteError(w, r, middleware.ErrInternal)
+		return
+	}
+	balance := 0
+	for _, entry := range entries {
+		if entry.Confirmed {
+			balance += entry.Type.Signed(entry.Amount)
+		}
+	}
+	now := today()
+	dailyAllowance := averageDailyAllowance(entries, now)
+
+	rows, err := dbPool.Query(r.Context(), "SELECT id, user_id, name, target_amount, deadline, image_url FROM savings_goals WHERE user_id=$1 ORDER BY created_at", userID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to execute query", "error", err)
+		middleware.WriteError(w, r, middleware.ErrInternal)
+		return
+	}
+	defer rows.Close()
+
+	goals := []pocketMoneyModels.SavingsGoal{}
+	for rows.Next() {
+		var goal pocketMoneyModels.SavingsGoal
+		var deadline *time.Time
+		if err := rows.Scan(&goal.ID, &goal.UserID, &goal.Name, &goal.TargetAmount, &deadline, &goal.ImageURL); err != nil {
+			slog.ErrorContext(r.Context(), "Failed to scan row", "error", err)
+			middleware.WriteError(w, r, middleware.ErrInternal)
+			return
+		}
+		if deadline != nil {
+			goal.Deadline = &models.DateOnly{Time: *deadline}
+		}
+		applyProgress(&goal, balance, dailyAllowance, now)
+		goals = append(goals, goal)
+	}
+	json.NewEncoder(w).Encode(goals)
+}
+
+func createGoal(w http.ResponseWriter, r *http.Request, userID int) {
+	req, ok := decodeGoalRequest(w, r)
+	if !ok {
+		return
+	}
+	goal := pocketMoneyModels.SavingsGoal{UserID: userID, Name: req.Name, TargetAmount: req.TargetAmount, Deadline: req.Deadline, ImageURL: req.ImageURL}
+	err := dbPool.QueryRow(r.Context(), "INSERT INTO savings_goals (user_id, name, target_amount, deadline, image_url) VALUES ($1, $2, $3, $4, $5) RETURNING id",
+		userID, req.Name, req.TargetAmount, dateOrNil(req.Deadline), req.ImageURL).Scan(&goal.ID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to execute query", "error", err)
+		middleware.WriteError(w, r, middleware.ErrInternal)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(goal)
+}
+
+func decodeGoalRequest(w http.ResponseWriter, r *http.Request) (pocketMoneyModels.GoalRequest, bool) {
+	var req pocketMoneyModels.GoalRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		slog.InfoContext(r.Context(), "Invalid request payload", "error", err)
+		middleware.WriteError(w, r, middleware.ErrInvalidPayload)
+		return req, false
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" || req.TargetAmount <= 0 {
+		middleware.WriteError(w, r, middleware.NewError(http.StatusBadRequest, "invalid_goal", "name and a positive targetAmount are required"))
+		return req, false
+	}
+	if req.ImageURL != "" {
+		if u, err := url.Parse(req.ImageURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			middleware.WriteError(w, r, middleware.NewError(http.StatusBadRequest, "invalid_image_url", "imageUrl must be an http(s) URL"))
+			return req, false
+		}
+	}
+	return req, true
+}
+
+// applyProgress fills the computed fields of a goal. The whole confirmed balance counts towards every goal,
+// the projection assumes allowances keep coming at their recent average rate.
+func applyProgress(goal *pocketMoneyModels.SavingsGoal, balance int, dailyAllowance float64, now time.Time) {
+	goal.Saved = min(max(balance, 0), goal.TargetAmount)
+	goal.Remaining = goal.TargetAmount - goal.Saved
+	goal.Percent = goal.Saved * 100 / goal.TargetAmount
+	goal.Completed = goal.Remaining == 0
+	switch {
+	case goal.Completed:
+		goal.ProjectedCompletion = &models.DateOnly{Time: now}
+	case dailyAllowance > 0:
+		days := int(math.Ceil(float64(goal.Remaining) / dailyAllowance))
+		goal.ProjectedCompletion = &models.DateOnly{Time: now.AddDate(0, 0, days)}
+	}
+}
+
+// averageDailyAllowance averages the allowances of the last allowanceWindow, or since the first allowance if that is more recent.
+func averageDailyAllowance(entries []pocketMoneyModels.PocketMoneyEntry, now time.Time) float64 {
+	windowStart := now.Add(-allowanceWindow)
+	var first time.Time
+	total := 0
+	for _, entry := range entries {
+		if entry.Type != pocketMoneyModels.Allowance || entry.Date.Before(windowStart) || entry.Date.After(now) {
+			continue
+		}
+		if first.IsZero() || entry.Date.Before(first) {
+			first = entry.Date.Time
+		}
+		total += entry.Amount
+	}
+	if total == 0 {
+		return 0
+	}
+	days := now.Sub(first).Hours() / 24
+	// A single payment today still describes at least a week of allowance
+	days = max(days, 7)
+	return float64(total) / days
+}
+
+func dateOrNil(d *models.DateOnly) *string {
+	if d == nil {
+		return nil
+	}
+	formatted := d.Format(time.DateOnly)
+	return &formatted
+}
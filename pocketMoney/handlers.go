@@ -1,14 +1,16 @@
 package pocketMoney
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"homeApplications/middleware"
 	"homeApplications/models"
 	pocketMoneyModels "homeApplications/pocketMoney/models"
-	"log"
+	"log/slog"
 	"net/http"
 	"strconv"
 	"strings"
@@ -25,35 +27,43 @@ func SetDBConnection(pool *pgxpool.Pool) {
 
 func CreateAction(w http.ResponseWriter, r *http.Request) {
 	middleware.EnableCors(&w)
-	_, err := middleware.CheckAuthorization(r, models.Admin)
+	appUser, err := middleware.CheckAuthorization(r, models.PermPocketMoneyCreate)
 	if err != nil {
-		middleware.HandleError(w, err)
+		middleware.WriteError(w, r, err)
 		return
 	}
 
 	var req pocketMoneyModels.CreateRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		log.Println(err.Error())
-		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		slog.InfoContext(r.Context(), "Invalid request payload", "error", err)
+		middleware.WriteError(w, r, middleware.ErrInvalidPayload)
 		return
 	}
 
+	if req.Type == "" {
+		req.Type = pocketMoneyModels.Allowance
+	}
+	if !req.Type.IsValid() || req.Amount <= 0 {
+		middleware.WriteError(w, r, middleware.NewError(http.StatusBadRequest, "invalid_entry", "Invalid entry type or amount"))
+		return
+	}
+
+	// The entry belongs to the household of the receiver, which has to be the household of the caller
 	var newID int
-	err = dbPool.QueryRow(r.Context(), "INSERT INTO pocket_money (receiver_user_id, amount, specific_date) VALUES ($1, $2, $3) RETURNING id",
-		req.UserID, req.Amount, req.Date.Format("2006-01-02")).Scan(&newID)
+	condition, household := middleware.OwnHousehold(*appUser).Where("household_id", 6)
+	err = dbPool.QueryRow(r.Context(), `INSERT INTO pocket_money (receiver_user_id, amount, specific_date, entry_type, description, household_id)
+		SELECT id, $2, $3, $4, $5, household_id FROM users WHERE id=$1 AND `+condition+` RETURNING id`,
+		req.UserID, req.Amount, req.Date.Format("2006-01-02"), req.Type, req.Description, household).Scan(&newID)
 	if err != nil {
 		var pgErr *pgconn.PgError
-		var errMsg string
-		var errCode int
-		if errors.As(err, &pgErr) && pgErr.Code == "23505" { // 23505 is the PostgreSQL error code for unique constraint violation
-			errMsg = "Entry for the given date already exists"
-			errCode = http.StatusConflict
-		} else {
-			errMsg = "Internal server error"
-			errCode = http.StatusInternalServerError
+		apiErr := middleware.ErrInternal
+		if errors.Is(err, pgx.ErrNoRows) {
+			apiErr = middleware.ErrUserNotFound
+		} else if errors.As(err, &pgErr) && pgErr.Code == "23505" { // 23505 is the PostgreSQL error code for unique constraint violation
+			apiErr = middleware.NewError(http.StatusConflict, "allowance_exists", "Allowance for the given date already exists")
 		}
-		log.Println("Failed to execute query: " + err.Error())
-		http.Error(w, errMsg, errCode)
+		slog.ErrorContext(r.Context(), "Failed to execute query", "error", err)
+		middleware.WriteError(w, r, apiErr)
 		return
 	}
 
@@ -63,21 +73,21 @@ func CreateAction(w http.ResponseWriter, r *http.Request) {
 
 func AcknowledgeAction(w http.ResponseWriter, r *http.Request) {
 	middleware.EnableCors(&w)
-	user, err := middleware.CheckAuthorization(r, models.User)
+	user, err := middleware.CheckAuthorization(r, models.PermPocketMoneyAcknowledge)
 	if err != nil {
-		middleware.HandleError(w, err)
+		middleware.WriteError(w, r, err)
 		return
 	}
 
 	// Implementation for recording actions
 	var req pocketMoneyModels.AcknowledgeRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		log.Println(err.Error())
-		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		slog.InfoContext(r.Context(), "Invalid request payload", "error", err)
+		middleware.WriteError(w, r, middleware.ErrInvalidPayload)
 		return
 	}
 
-	log.Println("action acknowledged:", req)
+	slog.InfoContext(r.Context(), "Action acknowledged", "request", req)
 
 	switch req.Action {
 	case pocketMoneyModels.Confirm:
@@ -86,12 +96,12 @@ func AcknowledgeAction(w http.ResponseWriter, r *http.Request) {
 	case pocketMoneyModels.Refute:
 		_, err = dbPool.Exec(r.Context(), "UPDATE pocket_money SET confirmed = FALSE WHERE receiver_user_id=$1 AND id =$2", user.ID, req.EntryID)
 	default:
-		http.Error(w, "Invalid action", http.StatusBadRequest)
+		middleware.WriteError(w, r, middleware.NewError(http.StatusBadRequest, "invalid_action", "Invalid action"))
 		return
 	}
 	if err != nil {
-		log.Println(err.Error())
-		http.Error(w, "DB error", http.StatusBadRequest)
+		slog.ErrorContext(r.Context(), "Failed to execute query", "error", err)
+		middleware.WriteError(w, r, middleware.ErrInternal)
 		return
 	}
 	w.WriteHeader(http.StatusOK)
@@ -102,51 +112,76 @@ func GetActions(w http.ResponseWriter, r *http.Request) {
 	middleware.EnableCors(&w)
 	appUser, err := middleware.AuthenticateUser(r)
 	if err != nil {
-		middleware.HandleError(w, err)
+		middleware.WriteError(w, r, err)
 		return
 	}
 
 	userIDStr := strings.TrimPrefix(r.URL.Path, "/pocketMoney/")
 	if userIDStr == "" {
-		http.Error(w, "User ID is required", http.StatusBadRequest)
+		middleware.WriteError(w, r, middleware.NewError(http.StatusBadRequest, "user_id_required", "User ID is required"))
 		return
 	}
 	userID, err := strconv.Atoi(userIDStr)
 	if err != nil {
-		http.Error(w, "Invalid User ID", http.StatusBadRequest)
+		middleware.WriteError(w, r, middleware.ErrInvalidUserID)
 		return
 	}
-	if !(appUser.Access == models.Admin || appUser.ID == userID) {
-		http.Error(w, "Unauthorized access", http.StatusForbidden)
+	if !canAccessUser(r.Context(), appUser, userID) {
+		middleware.WriteError(w, r, middleware.ErrForbidden)
 		return
 	}
 
-	rows, err := dbPool.Query(r.Context(), "SELECT * FROM pocket_money WHERE receiver_user_id=$1", userID)
+	pocketMoneyActions, err := loadEntries(r.Context(), userID)
 	if err != nil {
-		log.Println("Failed to execute query: " + err.Error())
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		slog.ErrorContext(r.Context(), "Failed to load entries", "error", err)
+		middleware.WriteError(w, r, middleware.ErrInternal)
 		return
 	}
+
+	if len(pocketMoneyActions) == 0 {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("[]"))
+		return
+	}
+	// Implementation for fetching actions
+	json.NewEncoder(w).Encode(pocketMoneyActions)
+}
+
+// canAccessUser reports whether appUser may see the pocket money of userID.
+func canAccessUser(ctx context.Context, appUser models.AppUser, userID int) bool {
+	if appUser.ID == userID {
+		return middleware.HasPermission(ctx, appUser, models.PermPocketMoneyReadOwn)
+	}
+	if !middleware.HasPermission(ctx, appUser, models.PermPocketMoneyReadAll) {
+		return false
+	}
+	same, err := middleware.OwnHousehold(appUser).HasUser(ctx, userID)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to check household", "error", err)
+		return false
+	}
+	return same
+}
+
+// loadEntries returns all pocket money entries of a user in booking order.
+func loadEntries(ctx context.Context, userID int) ([]pocketMoneyModels.PocketMoneyEntry, error) {
+	rows, err := dbPool.Query(ctx, `SELECT id, receiver_user_id, amount, specific_date, COALESCE(confirmed, FALSE), entry_type, description
+		FROM pocket_money WHERE receiver_user_id=$1 ORDER BY specific_date, id`, userID)
+	if err != nil {
+		return nil, err
+	}
 	defer rows.Close()
 
 	var pocketMoneyActions []pocketMoneyModels.PocketMoneyEntry
 	for rows.Next() {
 		var specificDate time.Time
 		var pocketMoneyAction pocketMoneyModels.PocketMoneyEntry
-		if err := rows.Scan(&pocketMoneyAction.ID, &pocketMoneyAction.UserID, &pocketMoneyAction.Amount, &specificDate, &pocketMoneyAction.Confirmed); err != nil {
-			log.Println("Failed to scan row: " + err.Error())
-			http.Error(w, "Internal server error", http.StatusInternalServerError)
-			return
+		if err := rows.Scan(&pocketMoneyAction.ID, &pocketMoneyAction.UserID, &pocketMoneyAction.Amount, &specificDate, &pocketMoneyAction.Confirmed,
+			&pocketMoneyAction.Type, &pocketMoneyAction.Description); err != nil {
+			return nil, err
 		}
 		pocketMoneyAction.Date = models.DateOnly{Time: specificDate}
 		pocketMoneyActions = append(pocketMoneyActions, pocketMoneyAction)
 	}
-
-	if len(pocketMoneyActions) == 0 {
-		w.WriteHeader(http.StatusOK)
-		w.Write([]byte("[]"))
-		return
-	}
-	// Implementation for fetching actions
-	json.NewEncoder(w).Encode(pocketMoneyActions)
+	return pocketMoneyActions, rows.Err()
 }
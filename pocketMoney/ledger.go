@@ -0,0 +1,95 @@
+package pocketMoney
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"homeApplications/middleware"
+	"homeApplications/models"
+	pocketMoneyModels "homeApplications/pocketMoney/models"
+)
+
+// GetBalance handles /pocketMoney/{id}/balance. Only confirmed entries count towards the balance.
+func GetBalance(w http.ResponseWriter, r *http.Request) {
+	middleware.EnableCors(&w)
+	_, userID, ok := authorizeUserFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	entries, err := loadEntries(r.Context(), userID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to load entries", "error", err)
+		middleware.WriteError(w, r, middleware.ErrInternal)
+		return
+	}
+
+	balance := pocketMoneyModels.Balance{UserID: userID}
+	for _, entry := range entries {
+		signed := entry.Type.Signed(entry.Amount)
+		if !entry.Confirmed {
+			balance.Pending += signed
+			continue
+		}
+		balance.Balance += signed
+		if entry.Type.IsDebit() {
+			balance.Debits += entry.Amount
+		} else {
+			balance.Credits += entry.Amount
+		}
+	}
+	json.NewEncoder(w).Encode(balance)
+}
+
+// GetHistory handles /pocketMoney/{id}/history: the entries of GetActions with the running balance after each one.
+func GetHistory(w http.ResponseWriter, r *http.Request) {
+	middleware.EnableCors(&w)
+	_, userID, ok := authorizeUserFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	entries, err := loadEntries(r.Context(), userID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to load entries", "error", err)
+		middleware.WriteError(w, r, middleware.ErrInternal)
+		return
+	}
+	json.NewEncoder(w).Encode(runningBalance(entries, 0))
+}
+
+// runningBalance turns entries into ledger lines, starting at the given opening balance.
+// Unconfirmed entries are listed but leave the balance unchanged.
+func runningBalance(entries []pocketMoneyModels.PocketMoneyEntry, opening int) []pocketMoneyModels.LedgerEntry {
+	ledger := make([]pocketMoneyModels.LedgerEntry, 0, len(entries))
+	balance := opening
+	for _, entry := range entries {
+		if entry.Confirmed {
+			balance += entry.Type.Signed(entry.Amount)
+		}
+		ledger = append(ledger, pocketMoneyModels.LedgerEntry{PocketMoneyEntry: entry, RunningBalance: balance})
+	}
+	return ledger
+}
+
+// authorizeUserFromPath authenticates the request and checks access to the user in the {id} path segment.
+// It writes the error response itself and returns ok=false in that case.
+func authorizeUserFromPath(w http.ResponseWriter, r *http.Request) (models.AppUser, int, bool) {
+	appUser, err := middleware.AuthenticateUser(r)
+	if err != nil {
+		middleware.WriteError(w, r, err)
+		return appUser, 0, false
+	}
+	userID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		middleware.WriteError(w, r, middleware.ErrInvalidUserID)
+		return appUser, 0, false
+	}
+	if !canAccessUser(r.Context(), appUser, userID) {
+		middleware.WriteError(w, r, middleware.ErrForbidden)
+		return appUser, 0, false
+	}
+	return appUser, userID, true
+}
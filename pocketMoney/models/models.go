@@ -16,16 +16,127 @@ type AcknowledgeRequest struct {
 	Action  AcknowledgeAction `json:"action"`
 }
 
+type EntryType string
+
+const (
+	Allowance       EntryType = "allowance"
+	Bonus           EntryType = "bonus"
+	Purchase        EntryType = "purchase"
+	Fine            EntryType = "fine"
+	SavingsTransfer EntryType = "savings_transfer"
+)
+
+// IsValid reports whether t is one of the known entry types.
+func (t EntryType) IsValid() bool {
+	switch t {
+	case Allowance, Bonus, Purchase, Fine, SavingsTransfer:
+		return true
+	}
+	return false
+}
+
+// IsDebit reports whether entries of this type reduce the balance.
+func (t EntryType) IsDebit() bool {
+	return t == Purchase || t == Fine || t == SavingsTransfer
+}
+
+// Signed returns the amount as it affects the balance, negative for debits.
+func (t EntryType) Signed(amount int) int {
+	if t.IsDebit() {
+		return -amount
+	}
+	return amount
+}
+
 type CreateRequest struct {
 	UserID int             `json:"userId"`
 	Date   models.DateOnly `json:"date"`
 	Amount int             `json:"amount"`
+	// Type defaults to allowance for clients that do not send it
+	Type        EntryType `json:"type"`
+	Description string    `json:"description"`
 }
 
 type PocketMoneyEntry struct {
-	ID        int             `json:"id"`
-	UserID    int             `json:"user_id"`
-	Amount    int             `json:"amount"`
-	Date      models.DateOnly `json:"date"`
-	Confirmed bool            `json:"confirmed"`
+	ID          int             `json:"id"`
+	UserID      int             `json:"user_id"`
+	Amount      int             `json:"amount"`
+	Date        models.DateOnly `json:"date"`
+	Confirmed   bool            `json:"confirmed"`
+	Type        EntryType       `json:"type"`
+	Description string          `json:"description"`
+}
+
+// LedgerEntry is a PocketMoneyEntry with the confirmed balance after it was booked.
+type LedgerEntry struct {
+	PocketMoneyEntry
+	RunningBalance int `json:"runningBalance"`
+}
+
+type Balance struct {
+	UserID int `json:"userId"`
+	// Balance only counts confirmed entries, Pending is the sum of the unconfirmed ones
+	Balance int `json:"balance"`
+	Pending int `json:"pending"`
+	Credits int `json:"credits"`
+	Debits  int `json:"debits"`
+}
+
+type Frequency string
+
+const (
+	Weekly   Frequency = "weekly"
+	Biweekly Frequency = "biweekly"
+	Monthly  Frequency = "monthly"
+	// Weekday pays every week on a fixed day, see Schedule.Weekday
+	Weekday Frequency = "weekday"
+)
+
+type Schedule struct {
+	ID        int       `json:"id"`
+	UserID    int       `json:"userId"`
+	Amount    int       `json:"amount"`
+	Frequency Frequency `json:"frequency"`
+	// Weekday is 0 (Sunday) to 6 (Saturday), only used with the weekday frequency
+	Weekday           *int             `json:"weekday,omitempty"`
+	StartDate         models.DateOnly  `json:"startDate"`
+	EndDate           *models.DateOnly `json:"endDate,omitempty"`
+	MaterializedUntil *models.DateOnly `json:"materializedUntil,omitempty"`
+}
+
+type SavingsGoal struct {
+	ID           int              `json:"id"`
+	UserID       int              `json:"userId"`
+	Name         string           `json:"name"`
+	TargetAmount int              `json:"targetAmount"`
+	Deadline     *models.DateOnly `json:"deadline,omitempty"`
+	ImageURL     string           `json:"imageUrl"`
+	// Saved is the part of the confirmed balance counting towards this goal
+	Saved     int  `json:"saved"`
+	Remaining int  `json:"remaining"`
+	Percent   int  `json:"percent"`
+	Completed bool `json:"completed"`
+	// ProjectedCompletion is nil when there is no allowance history to extrapolate from
+	ProjectedCompletion *models.DateOnly `json:"projectedCompletion,omitempty"`
+}
+
+type GoalRequest struct {
+	Name         string           `json:"name"`
+	TargetAmount int              `json:"targetAmount"`
+	Deadline     *models.DateOnly `json:"deadline"`
+	ImageURL     string           `json:"imageUrl"`
+}
+
+// Statement covers the entries of one user within [From, To]. Balances only count confirmed entries.
+type Statement struct {
+	UserID         int             `json:"userId"`
+	UserName       string          `json:"userName"`
+	From           models.DateOnly `json:"from"`
+	To             models.DateOnly `json:"to"`
+	OpeningBalance int             `json:"openingBalance"`
+	Entries        []LedgerEntry   `json:"entries"`
+	TotalCredits   int             `json:"totalCredits"`
+	TotalDebits    int             `json:"totalDebits"`
+	Pending        int             `json:"pending"`
+	ClosingBalance int             `json:"closingBalance"`
 }
@@ -0,0 +1,84 @@
+package pocketMoney
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestPDFEscape(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{value: "plain text", want: "plain text"},
+		{value: `a(b)c\d`, want: `a\(b\)c\\d`},
+		{value: "((", want: `\(\(`},
+		{value: "5 €", want: `5 \200`},
+		{value: "Grüße", want: `Gr\374\337e`},
+		{value: "tab\tnew\nline", want: "tab new line"},
+		{value: "日本", want: "??"},
+	}
+	for _, tt := range tests {
+		if got := pdfEscape(tt.value); got != tt.want {
+			t.Errorf("pdfEscape(%q) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestPDFDocument(t *testing.T) {
+	doc := newPDFDocument()
+	doc.text(0, 18, true, `Statement (Anna) \ May`)
+	// Enough rows for a second page
+	for i := range 60 {
+		doc.row([]float64{0, 100}, false, strconv.Itoa(i), "row")
+	}
+	if len(doc.pages) != 2 {
+		t.Fatalf("document has %d pages, want 2", len(doc.pages))
+	}
+	var out bytes.Buffer
+	if _, err := doc.WriteTo(&out); err != nil {
+		t.Fatal(err)
+	}
+	pdf := out.Bytes()
+
+	if !bytes.Contains(pdf, []byte(`(Statement \(Anna\) \\ May) Tj`)) {
+		t.Error("PDF misses the escaped title")
+	}
+
+	match := regexp.MustCompile(`startxref\n(\d+)\n%%EOF\n$`).FindSubmatch(pdf)
+	if match == nil {
+		t.Fatal("PDF does not end with startxref")
+	}
+	xref, _ := strconv.Atoi(string(match[1]))
+	if !bytes.HasPrefix(pdf[xref:], []byte("xref\n0 9\n0000000000 65535 f \n")) {
+		t.Fatalf("startxref %d does not point to the xref table of 8 objects: %q", xref, pdf[xref:min(xref+30, len(pdf))])
+	}
+	entries := strings.Split(string(pdf[xref:]), "\n")[3:11]
+	for i, entry := range entries {
+		if len(entry) != 19 || !strings.HasSuffix(entry, " 00000 n ") {
+			t.Fatalf("xref entry %d = %q, want a 10 digit offset and generation 0", i+1, entry)
+		}
+		offset, _ := strconv.Atoi(entry[:10])
+		if want := fmt.Sprintf("%d 0 obj\n", i+1); !bytes.HasPrefix(pdf[offset:], []byte(want)) {
+			t.Errorf("xref offset of object %d points to %q", i+1, pdf[offset:min(offset+10, len(pdf))])
+		}
+	}
+	if !bytes.Contains(pdf, []byte("trailer\n<< /Size 9 /Root 1 0 R >>")) {
+		t.Error("PDF trailer does not count 9 objects")
+	}
+
+	streams := regexp.MustCompile(`/Length (\d+) >>\nstream\n`).FindAllSubmatchIndex(pdf, -1)
+	if len(streams) != 2 {
+		t.Fatalf("PDF has %d content streams, want 2", len(streams))
+	}
+	for _, stream := range streams {
+		length, _ := strconv.Atoi(string(pdf[stream[2]:stream[3]]))
+		if end := stream[1] + length; !bytes.HasPrefix(pdf[end:], []byte("endstream")) {
+			t.Errorf("stream length %d does not end at endstream", length)
+		}
+	}
+}
@@ -0,0 +1,310 @@
+package pocketMoney
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"homeApplications/health"
+	"homeApplications/middleware"
+	"homeApplications/models"
+	pocketMoneyModels "homeApplications/pocketMoney/models"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// Schedules handles /pocketMoney/schedules: listing (optionally ?userId=), creating and deleting (?id=) recurring allowances.
+func Schedules(w http.ResponseWriter, r *http.Request) {
+	middleware.EnableCors(&w)
+	appUser, err := middleware.CheckAuthorization(r, models.PermPocketMoneySchedules)
+	if err != nil {
+		middleware.WriteError(w, r, err)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		listSchedules(w, r, middleware.OwnHousehold(*appUser))
+	case http.MethodPost:
+		createSchedule(w, r, middleware.OwnHousehold(*appUser))
+	case http.MethodDelete:
+		deleteSchedule(w, r, middleware.OwnHousehold(*appUser))
+	default:
+		middleware.WriteError(w, r, middleware.ErrMethodNotAllowed)
+	}
+}
+
+// deleteSchedule stops a recurring allowance. Entries that were already created are kept.
+func deleteSchedule(w http.ResponseWriter, r *http.Request, scope middleware.Scope) {
+	scheduleID, err := strconv.Atoi(r.URL.Query().Get("id"))
+	if err != nil {
+		middleware.WriteError(w, r, middleware.NewError(http.StatusBadRequest, "invalid_schedule_id", "Invalid schedule ID"))
+		return
+	}
+
+	condition, household := scope.Where("u.household_id", 2)
+	tag, err := dbPool.Exec(r.Context(), `DELETE FROM pocket_money_schedules s USING users u
+		WHERE s.id=$1 AND u.id = s.receiver_user_id AND `+condition, scheduleID, household)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to execute query", "error", err)
+		middleware.WriteError(w, r, middleware.ErrInternal)
+		return
+	}
+	if tag.RowsAffected() == 0 {
+		middleware.WriteError(w, r, middleware.NewError(http.StatusNotFound, "schedule_not_found", "Schedule not found"))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func listSchedules(w http.ResponseWriter, r *http.Request, scope middleware.Scope) {
+	condition, household := scope.Where("u.household_id", 1)
+	query := `SELECT s.id, s.receiver_user_id, s.amount, s.frequency, s.weekday, s.start_date, s.end_date, s.materialized_until
+		FROM pocket_money_schedules s JOIN users u ON u.id = s.receiver_user_id WHERE ` + condition
+	args := []any{household}
+	if userIDStr := r.URL.Query().Get("userId"); userIDStr != "" {
+		userID, err := strconv.Atoi(userIDStr)
+		if err != nil {
+			middleware.WriteError(w, r, middleware.ErrInvalidUserID)
+			return
+		}
+		query += " AND s.receiver_user_id=$2"
+		args = append(args, userID)
+	}
+	rows, err := dbPool.Query(r.Context(), query+" ORDER BY s.receiver_user_id, s.start_date", args...)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to execute query", "error", err)
+		middleware.WriteError(w, r, middleware.ErrInternal)
+		return
+	}
+	defer rows.Close()
+
+	schedules := []pocketMoneyModels.Schedule{}
+	for rows.Next() {
+		schedule, err := scanSchedule(rows)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Failed to scan row", "error", err)
+			middleware.WriteError(w, r, middleware.ErrInternal)
+			return
+		}
+		schedules = append(schedules, schedule)
+	}
+	json.NewEncoder(w).Encode(schedules)
+}
+
+func createSchedule(w http.ResponseWriter, r *http.Request, scope middleware.Scope) {
+	var req pocketMoneyModels.Schedule
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		slog.InfoContext(r.Context(), "Invalid request payload", "error", err)
+		middleware.WriteError(w, r, middleware.ErrInvalidPayload)
+		return
+	}
+	switch req.Frequency {
+	case pocketMoneyModels.Weekly, pocketMoneyModels.Biweekly, pocketMoneyModels.Monthly:
+		req.Weekday = nil
+	case pocketMoneyModels.Weekday:
+		if req.Weekday == nil || *req.Weekday < 0 || *req.Weekday > 6 {
+			middleware.WriteError(w, r, middleware.NewError(http.StatusBadRequest, "invalid_weekday", "weekday must be between 0 (Sunday) and 6 (Saturday)"))
+			return
+		}
+	default:
+		middleware.WriteError(w, r, middleware.NewError(http.StatusBadRequest, "invalid_frequency", "Invalid frequency"))
+		return
+	}
+	if req.StartDate.IsZero() || req.Amount <= 0 {
+		middleware.WriteError(w, r, middleware.NewError(http.StatusBadRequest, "invalid_schedule", "startDate and a positive amount are required"))
+		return
+	}
+	if req.EndDate != nil && req.EndDate.Before(req.StartDate.Time) {
+		middleware.WriteError(w, r, middleware.NewError(http.StatusBadRequest, "invalid_date_range", "endDate must not be before startDate"))
+		return
+	}
+
+	condition, household := scope.Where("household_id", 7)
+	err := dbPool.QueryRow(r.Context(), `INSERT INTO pocket_money_schedules (receiver_user_id, amount, frequency, weekday, start_date, end_date)
+		SELECT id, $2, $3, $4, $5, $6 FROM users WHERE id=$1 AND `+condition+` RETURNING id`,
+		req.UserID, req.Amount, req.Frequency, req.Weekday, req.StartDate.Format(time.DateOnly), dateOrNil(req.EndDate), household).Scan(&req.ID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			middleware.WriteError(w, r, middleware.ErrUserNotFound)
+			return
+		}
+		if pgErr, ok := errors.AsType[*pgconn.PgError](err); ok && pgErr.Code == "23503" { // 23503 is the PostgreSQL error code for foreign key violation
+			middleware.WriteError(w, r, middleware.ErrUserNotFound)
+			return
+		}
+		slog.ErrorContext(r.Context(), "Failed to execute query", "error", err)
+		middleware.WriteError(w, r, middleware.ErrInternal)
+		return
+	}
+
+	// Create the entries that are already due instead of waiting for the next scheduler run
+	if err := materializeSchedules(r.Context(), today()); err != nil {
+		slog.ErrorContext(r.Context(), "Failed to materialize schedules", "error", err)
+	}
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(req)
+}
+
+// RunScheduler materializes due recurring allowances on start and then periodically until ctx is cancelled.
+// Every run beats the "scheduler" heartbeat checked by /health/ready.
+func RunScheduler(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if middleware.IsDBReady() {
+			if err := materializeSchedules(ctx, today()); err != nil {
+				slog.ErrorContext(ctx, "Failed to materialize schedules", "error", err)
+			}
+		}
+		health.Beat("scheduler")
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// materializeSchedules creates pocket_money rows for every schedule date up to and including until.
+// Allowances that already exist for a date are left alone thanks to the unique allowance index on
+// (receiver_user_id, specific_date), which makes running it repeatedly or concurrently safe.
+func materializeSchedules(ctx context.Context, until time.Time) error {
+	rows, err := dbPool.Query(ctx, `SELECT id, receiver_user_id, amount, frequency, weekday, start_date, end_date, materialized_until
+		FROM pocket_money_schedules
+		WHERE start_date <= $1 AND (materialized_until IS NULL OR materialized_until < LEAST($1, COALESCE(end_date, $1)))`,
+		until.Format(time.DateOnly))
+	if err != nil {
+		return err
+	}
+	var schedules []pocketMoneyModels.Schedule
+	for rows.Next() {
+		schedule, err := scanSchedule(rows)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		schedules = append(schedules, schedule)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, schedule := range schedules {
+		if err := materializeSchedule(ctx, schedule, until); err != nil {
+			slog.ErrorContext(ctx, "Failed to materialize schedule", "scheduleId", schedule.ID, "error", err)
+		}
+	}
+	return nil
+}
+
+func materializeSchedule(ctx context.Context, schedule pocketMoneyModels.Schedule, until time.Time) error {
+	end := until
+	if schedule.EndDate != nil && schedule.EndDate.Before(end) {
+		end = schedule.EndDate.Time
+	}
+	from := schedule.StartDate.Time
+	if schedule.MaterializedUntil != nil {
+		from = schedule.MaterializedUntil.AddDate(0, 0, 1)
+	}
+
+	tx, err := dbPool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	for _, date := range scheduleDates(schedule, from, end) {
+		_, err := tx.Exec(ctx, `INSERT INTO pocket_money (receiver_user_id, amount, specific_date, household_id)
+			SELECT id, $2, $3, household_id FROM users WHERE id=$1
+			ON CONFLICT (receiver_user_id, specific_date) WHERE entry_type = 'allowance' DO NOTHING`,
+			schedule.UserID, schedule.Amount, date.Format(time.DateOnly))
+		if err != nil {
+			return err
+		}
+	}
+	if _, err := tx.Exec(ctx, "UPDATE pocket_money_schedules SET materialized_until=$1 WHERE id=$2", end.Format(time.DateOnly), schedule.ID); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// scheduleDates returns the payment dates of a schedule within [from, to].
+func scheduleDates(schedule pocketMoneyModels.Schedule, from, to time.Time) []time.Time {
+	start := schedule.StartDate.Time
+	var dates []time.Time
+	switch schedule.Frequency {
+	case pocketMoneyModels.Weekly, pocketMoneyModels.Biweekly:
+		step := 7
+		if schedule.Frequency == pocketMoneyModels.Biweekly {
+			step = 14
+		}
+		for date := start; !date.After(to); date = date.AddDate(0, 0, step) {
+			if !date.Before(from) {
+				dates = append(dates, date)
+			}
+		}
+	case pocketMoneyModels.Weekday:
+		if schedule.Weekday == nil {
+			return nil
+		}
+		date := start.AddDate(0, 0, (*schedule.Weekday-int(start.Weekday())+7)%7)
+		for ; !date.After(to); date = date.AddDate(0, 0, 7) {
+			if !date.Before(from) {
+				dates = append(dates, date)
+			}
+		}
+	case pocketMoneyModels.Monthly:
+		// Paid on the day of the month of the start date, or the last day of shorter months
+		for month := 0; ; month++ {
+			date := monthlyDate(start, month)
+			if date.After(to) {
+				break
+			}
+			if !date.Before(from) {
+				dates = append(dates, date)
+			}
+		}
+	}
+	return dates
+}
+
+func monthlyDate(start time.Time, months int) time.Time {
+	firstOfMonth := time.Date(start.Year(), start.Month()+time.Month(months), 1, 0, 0, 0, 0, time.UTC)
+	lastDay := firstOfMonth.AddDate(0, 1, -1).Day()
+	return firstOfMonth.AddDate(0, 0, min(start.Day(), lastDay)-1)
+}
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanSchedule(row scanner) (pocketMoneyModels.Schedule, error) {
+	var schedule pocketMoneyModels.Schedule
+	var startDate time.Time
+	var endDate, materializedUntil *time.Time
+	if err := row.Scan(&schedule.ID, &schedule.UserID, &schedule.Amount, &schedule.Frequency, &schedule.Weekday,
+		&startDate, &endDate, &materializedUntil); err != nil {
+		return schedule, err
+	}
+	schedule.StartDate = models.DateOnly{Time: startDate}
+	if endDate != nil {
+		schedule.EndDate = &models.DateOnly{Time: *endDate}
+	}
+	if materializedUntil != nil {
+		schedule.MaterializedUntil = &models.DateOnly{Time: *materializedUntil}
+	}
+	return schedule, nil
+}
+
+// today returns the current local date at midnight UTC, the representation used for DATE columns.
+func today() time.Time {
+	now := time.Now()
+	return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+}
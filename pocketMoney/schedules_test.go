@@ -0,0 +1,101 @@
+package pocketMoney
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"homeApplications/models"
+	pocketMoneyModels "homeApplications/pocketMoney/models"
+)
+
+func date(year int, month time.Month, day int) time.Time {
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+func TestMonthlyDate(t *testing.T) {
+	tests := []struct {
+		start  time.Time
+		months int
+		want   time.Time
+	}{
+		{start: date(2024, 1, 15), months: 0, want: date(2024, 1, 15)},
+		{start: date(2024, 1, 15), months: 1, want: date(2024, 2, 15)},
+		{start: date(2024, 1, 31), months: 1, want: date(2024, 2, 29)},
+		{start: date(2023, 1, 31), months: 1, want: date(2023, 2, 28)},
+		{start: date(2024, 1, 31), months: 2, want: date(2024, 3, 31)},
+		{start: date(2024, 1, 31), months: 3, want: date(2024, 4, 30)},
+		{start: date(2024, 3, 30), months: 11, want: date(2025, 2, 28)},
+		{start: date(2024, 11, 30), months: 2, want: date(2025, 1, 30)},
+	}
+	for _, tt := range tests {
+		if got := monthlyDate(tt.start, tt.months); !got.Equal(tt.want) {
+			t.Errorf("monthlyDate(%s, %d) = %s, want %s", tt.start.Format(time.DateOnly), tt.months, got.Format(time.DateOnly), tt.want.Format(time.DateOnly))
+		}
+	}
+}
+
+func TestScheduleDates(t *testing.T) {
+	saturday := int(time.Saturday)
+	tests := []struct {
+		name      string
+		frequency pocketMoneyModels.Frequency
+		weekday   *int
+		start     time.Time
+		from, to  time.Time
+		want      []time.Time
+	}{
+		{
+			name: "weekly", frequency: pocketMoneyModels.Weekly, start: date(2024, 5, 1),
+			from: date(2024, 5, 1), to: date(2024, 5, 22),
+			want: []time.Time{date(2024, 5, 1), date(2024, 5, 8), date(2024, 5, 15), date(2024, 5, 22)},
+		},
+		{
+			name: "weekly from a later date", frequency: pocketMoneyModels.Weekly, start: date(2024, 5, 1),
+			from: date(2024, 5, 10), to: date(2024, 5, 31),
+			want: []time.Time{date(2024, 5, 15), date(2024, 5, 22), date(2024, 5, 29)},
+		},
+		{
+			name: "biweekly", frequency: pocketMoneyModels.Biweekly, start: date(2024, 5, 1),
+			from: date(2024, 5, 1), to: date(2024, 6, 1),
+			want: []time.Time{date(2024, 5, 1), date(2024, 5, 15), date(2024, 5, 29)},
+		},
+		{
+			name: "weekday", frequency: pocketMoneyModels.Weekday, weekday: &saturday, start: date(2024, 5, 1),
+			from: date(2024, 5, 1), to: date(2024, 5, 20),
+			want: []time.Time{date(2024, 5, 4), date(2024, 5, 11), date(2024, 5, 18)},
+		},
+		{
+			name: "weekday of the start date", frequency: pocketMoneyModels.Weekday, weekday: &saturday, start: date(2024, 5, 4),
+			from: date(2024, 5, 1), to: date(2024, 5, 11),
+			want: []time.Time{date(2024, 5, 4), date(2024, 5, 11)},
+		},
+		{
+			name: "weekday missing", frequency: pocketMoneyModels.Weekday, start: date(2024, 5, 1),
+			from: date(2024, 5, 1), to: date(2024, 5, 31),
+		},
+		{
+			name: "monthly at the end of the month", frequency: pocketMoneyModels.Monthly, start: date(2024, 1, 31),
+			from: date(2024, 1, 1), to: date(2024, 5, 31),
+			want: []time.Time{date(2024, 1, 31), date(2024, 2, 29), date(2024, 3, 31), date(2024, 4, 30), date(2024, 5, 31)},
+		},
+		{
+			name: "monthly from a later date", frequency: pocketMoneyModels.Monthly, start: date(2024, 1, 15),
+			from: date(2024, 3, 16), to: date(2024, 5, 15),
+			want: []time.Time{date(2024, 4, 15), date(2024, 5, 15)},
+		},
+		{
+			name: "range before the start", frequency: pocketMoneyModels.Monthly, start: date(2024, 6, 1),
+			from: date(2024, 1, 1), to: date(2024, 5, 31),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schedule := pocketMoneyModels.Schedule{Frequency: tt.frequency, Weekday: tt.weekday, StartDate: models.DateOnly{Time: tt.start}}
+			got := scheduleDates(schedule, tt.from, tt.to)
+			if !slices.EqualFunc(got, tt.want, time.Time.Equal) {
+				t.Errorf("scheduleDates() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,190 @@
+package pocketMoney
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"strconv"
+	"time"
+
+	"homeApplications/middleware"
+	"homeApplications/models"
+	pocketMoneyModels "homeApplications/pocketMoney/models"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// GetStatement handles /pocketMoney/{id}/statement?from=&to=&format=csv|pdf.
+// The period defaults to the current month up to today, the format to csv.
+func GetStatement(w http.ResponseWriter, r *http.Request) {
+	middleware.EnableCors(&w)
+	_, userID, ok := authorizeUserFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	now := today()
+	from := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	to := now
+	var err error
+	if v := r.URL.Query().Get("from"); v != "" {
+		if from, err = time.Parse(time.DateOnly, v); err != nil {
+			middleware.WriteError(w, r, middleware.NewError(http.StatusBadRequest, "invalid_from_date", "Invalid from date, expected YYYY-MM-DD"))
+			return
+		}
+	}
+	if v := r.URL.Query().Get("to"); v != "" {
+		if to, err = time.Parse(time.DateOnly, v); err != nil {
+			middleware.WriteError(w, r, middleware.NewError(http.StatusBadRequest, "invalid_to_date", "Invalid to date, expected YYYY-MM-DD"))
+			return
+		}
+	}
+	if to.Before(from) {
+		middleware.WriteError(w, r, middleware.NewError(http.StatusBadRequest, "invalid_date_range", "to must not be before from"))
+		return
+	}
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "csv"
+	}
+	if format != "csv" && format != "pdf" {
+		middleware.WriteError(w, r, middleware.NewError(http.StatusBadRequest, "invalid_format", "Invalid format, expected csv or pdf"))
+		return
+	}
+
+	statement := pocketMoneyModels.Statement{UserID: userID, From: models.DateOnly{Time: from}, To: models.DateOnly{Time: to}}
+	if err := dbPool.QueryRow(r.Context(), "SELECT name FROM users WHERE id=$1", userID).Scan(&statement.UserName); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			middleware.WriteError(w, r, middleware.ErrUserNotFound)
+			return
+		}
+		slog.ErrorContext(r.Context(), "Failed to execute query", "error", err)
+		middleware.WriteError(w, r, middleware.ErrInternal)
+		return
+	}
+	entries, err := loadEntries(r.Context(), userID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to load entries", "error", err)
+		middleware.WriteError(w, r, middleware.ErrInternal)
+		return
+	}
+	buildStatement(&statement, entries)
+
+	filename := fmt.Sprintf("statement-%s-%s-%s.%s", statement.UserName, from.Format(time.DateOnly), to.Format(time.DateOnly), format)
+	// The user name can hold any character, FormatMediaType quotes it or switches to filename* for non-ASCII names
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+	switch format {
+	case "csv":
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		err = writeStatementCSV(w, statement)
+	case "pdf":
+		w.Header().Set("Content-Type", "application/pdf")
+		_, err = statementPDF(statement).WriteTo(w)
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to write statement", "error", err)
+	}
+}
+
+// buildStatement splits the entries into the opening balance and the lines of the period.
+func buildStatement(statement *pocketMoneyModels.Statement, entries []pocketMoneyModels.PocketMoneyEntry) {
+	var period []pocketMoneyModels.PocketMoneyEntry
+	for _, entry := range entries {
+		switch {
+		case entry.Date.Before(statement.From.Time):
+			if entry.Confirmed {
+				statement.OpeningBalance += entry.Type.Signed(entry.Amount)
+			}
+		case !entry.Date.After(statement.To.Time):
+			period = append(period, entry)
+			if !entry.Confirmed {
+				statement.Pending += entry.Type.Signed(entry.Amount)
+			} else if entry.Type.IsDebit() {
+				statement.TotalDebits += entry.Amount
+			} else {
+				statement.TotalCredits += entry.Amount
+			}
+		}
+	}
+	statement.Entries = runningBalance(period, statement.OpeningBalance)
+	statement.ClosingBalance = statement.OpeningBalance + statement.TotalCredits - statement.TotalDebits
+}
+
+func writeStatementCSV(w io.Writer, statement pocketMoneyModels.Statement) error {
+	writer := csv.NewWriter(w)
+	records := [][]string{
+		{"Statement", statement.UserName},
+		{"Period", statement.From.Format(time.DateOnly), statement.To.Format(time.DateOnly)},
+		{"Opening balance", strconv.Itoa(statement.OpeningBalance)},
+		{},
+		{"Date", "Type", "Description", "Amount", "Confirmed", "Balance"},
+	}
+	for _, entry := range statement.Entries {
+		records = append(records, []string{
+			entry.Date.Format(time.DateOnly),
+			string(entry.Type),
+			entry.Description,
+			strconv.Itoa(entry.Type.Signed(entry.Amount)),
+			strconv.FormatBool(entry.Confirmed),
+			strconv.Itoa(entry.RunningBalance),
+		})
+	}
+	records = append(records,
+		[]string{},
+		[]string{"Total credits", strconv.Itoa(statement.TotalCredits)},
+		[]string{"Total debits", strconv.Itoa(statement.TotalDebits)},
+		[]string{"Pending", strconv.Itoa(statement.Pending)},
+		[]string{"Closing balance", strconv.Itoa(statement.ClosingBalance)},
+	)
+	if err := writer.WriteAll(records); err != nil {
+		return err
+	}
+	return writer.Error()
+}
+
+func statementPDF(statement pocketMoneyModels.Statement) *pdfDocument {
+	doc := newPDFDocument()
+	doc.text(0, 18, true, "Pocket money statement")
+	doc.y -= 28
+	summary := []float64{0, 120}
+	doc.row(summary, false, "Name", statement.UserName)
+	doc.row(summary, false, "Period", statement.From.Format("02.01.2006")+" - "+statement.To.Format("02.01.2006"))
+	doc.row(summary, true, "Opening balance", strconv.Itoa(statement.OpeningBalance))
+	doc.space()
+
+	columns := []float64{0, 70, 170, 330, 390, 450}
+	doc.row(columns, true, "Date", "Type", "Description", "Amount", "Status", "Balance")
+	doc.line()
+	for _, entry := range statement.Entries {
+		status := "open"
+		if entry.Confirmed {
+			status = "confirmed"
+		}
+		description := entry.Description
+		if len([]rune(description)) > 28 {
+			description = string([]rune(description)[:25]) + "..."
+		}
+		doc.row(columns, false,
+			entry.Date.Format("02.01.2006"),
+			string(entry.Type),
+			description,
+			fmt.Sprintf("%+d", entry.Type.Signed(entry.Amount)),
+			status,
+			strconv.Itoa(entry.RunningBalance),
+		)
+	}
+	if len(statement.Entries) == 0 {
+		doc.row(columns, false, "", "No entries in this period")
+	}
+	doc.line()
+	doc.space()
+	doc.row(summary, false, "Total credits", strconv.Itoa(statement.TotalCredits))
+	doc.row(summary, false, "Total debits", strconv.Itoa(statement.TotalDebits))
+	doc.row(summary, false, "Pending", strconv.Itoa(statement.Pending))
+	doc.row(summary, true, "Closing balance", strconv.Itoa(statement.ClosingBalance))
+	return doc
+}
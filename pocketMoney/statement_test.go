@@ -0,0 +1,106 @@
+package pocketMoney
+
+import (
+	"bytes"
+	"encoding/csv"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+
+	"homeApplications/models"
+	pocketMoneyModels "homeApplications/pocketMoney/models"
+)
+
+func entry(day time.Time, entryType pocketMoneyModels.EntryType, amount int, confirmed bool, description string) pocketMoneyModels.PocketMoneyEntry {
+	return pocketMoneyModels.PocketMoneyEntry{Date: models.DateOnly{Time: day}, Type: entryType, Amount: amount, Confirmed: confirmed, Description: description}
+}
+
+// testStatement is May 2024 of a fixed ledger, with entries before and after the period.
+func testStatement() pocketMoneyModels.Statement {
+	entries := []pocketMoneyModels.PocketMoneyEntry{
+		entry(date(2024, 4, 20), pocketMoneyModels.Allowance, 500, true, "April"),
+		entry(date(2024, 4, 25), pocketMoneyModels.Purchase, 200, false, "never confirmed"),
+		entry(date(2024, 4, 28), pocketMoneyModels.Fine, 50, true, "late"),
+		entry(date(2024, 5, 1), pocketMoneyModels.Allowance, 500, true, "May"),
+		entry(date(2024, 5, 3), pocketMoneyModels.Purchase, 120, true, `Comic, "special" (issue #3)`),
+		entry(date(2024, 5, 10), pocketMoneyModels.Bonus, 100, false, "garden"),
+		entry(date(2024, 5, 15), pocketMoneyModels.SavingsTransfer, 300, true, "bike"),
+		entry(date(2024, 5, 20), pocketMoneyModels.Purchase, 40, false, "ice cream"),
+		entry(date(2024, 5, 31), pocketMoneyModels.Bonus, 25, true, "car wash"),
+		entry(date(2024, 6, 1), pocketMoneyModels.Allowance, 500, true, "June"),
+	}
+	statement := pocketMoneyModels.Statement{UserName: "Anna", From: models.DateOnly{Time: date(2024, 5, 1)}, To: models.DateOnly{Time: date(2024, 5, 31)}}
+	buildStatement(&statement, entries)
+	return statement
+}
+
+func TestBuildStatement(t *testing.T) {
+	statement := testStatement()
+	if statement.OpeningBalance != 450 || statement.TotalCredits != 525 || statement.TotalDebits != 420 ||
+		statement.Pending != 60 || statement.ClosingBalance != 555 {
+		t.Errorf("buildStatement() opening %d, credits %d, debits %d, pending %d, closing %d, want 450, 525, 420, 60, 555",
+			statement.OpeningBalance, statement.TotalCredits, statement.TotalDebits, statement.Pending, statement.ClosingBalance)
+	}
+	var balances []int
+	for _, e := range statement.Entries {
+		balances = append(balances, e.RunningBalance)
+	}
+	if want := []int{950, 830, 830, 530, 530, 555}; !slices.Equal(balances, want) {
+		t.Errorf("buildStatement() running balances = %v, want %v", balances, want)
+	}
+}
+
+func TestWriteStatementCSV(t *testing.T) {
+	statement := testStatement()
+	var out bytes.Buffer
+	if err := writeStatementCSV(&out, statement); err != nil {
+		t.Fatal(err)
+	}
+	reader := csv.NewReader(&out)
+	reader.FieldsPerRecord = -1
+	records, err := reader.ReadAll()
+	if err != nil {
+		t.Fatalf("statement is no valid CSV: %v", err)
+	}
+
+	values := map[string]string{}
+	var lines [][]string
+	for _, record := range records {
+		switch {
+		case len(record) == 2 || len(record) == 3:
+			values[record[0]] = record[1]
+		case len(record) == 6 && record[0] != "Date":
+			lines = append(lines, record)
+		}
+	}
+	for key, want := range map[string]string{
+		"Statement": "Anna", "Period": "2024-05-01", "Opening balance": "450", "Total credits": "525",
+		"Total debits": "420", "Pending": "60", "Closing balance": "555",
+	} {
+		if values[key] != want {
+			t.Errorf("CSV %s = %q, want %q", key, values[key], want)
+		}
+	}
+
+	if len(lines) != 6 {
+		t.Fatalf("CSV has %d entries, want 6", len(lines))
+	}
+	if got := lines[1][2]; got != `Comic, "special" (issue #3)` {
+		t.Errorf("CSV description = %q", got)
+	}
+	// The confirmed amounts add up from the opening to the closing balance
+	balance := 450
+	for _, line := range lines {
+		amount, _ := strconv.Atoi(line[3])
+		if line[4] == "true" {
+			balance += amount
+		}
+		if line[5] != strconv.Itoa(balance) {
+			t.Errorf("CSV balance of %s = %s, want %d", line[0], line[5], balance)
+		}
+	}
+	if balance != 555 {
+		t.Errorf("CSV entries end at %d, want the closing balance 555", balance)
+	}
+}
@@ -0,0 +1,21 @@
+ALTER TABLE users
+    ADD COLUMN locked_until TIMESTAMPTZ;
+
+-- Every lockout is kept so admins can review attacks, even after the account was unlocked
+CREATE TABLE lockout_events
+(
+    id           SERIAL PRIMARY KEY,
+    user_id      INT,
+    username     VARCHAR(100) NOT NULL,
+    ip_address   VARCHAR(45)  NOT NULL,
+    reason       VARCHAR(20)  NOT NULL,
+    failures     INT          NOT NULL,
+    locked_until TIMESTAMPTZ  NOT NULL,
+    created_at   TIMESTAMPTZ  NOT NULL DEFAULT NOW(),
+    unlocked_at  TIMESTAMPTZ,
+    unlocked_by  INT,
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE SET NULL,
+    FOREIGN KEY (unlocked_by) REFERENCES users (id) ON DELETE SET NULL
+);
+
+CREATE INDEX lockout_events_user_id_idx ON lockout_events (user_id);
@@ -0,0 +1,16 @@
+-- totp_secret is set on enrollment, totp_enabled once the first code was verified
+ALTER TABLE users
+    ADD COLUMN totp_secret    VARCHAR(64),
+    ADD COLUMN totp_enabled   BOOLEAN NOT NULL DEFAULT FALSE,
+    ADD COLUMN totp_last_step BIGINT;
+
+CREATE TABLE recovery_codes
+(
+    id        SERIAL PRIMARY KEY,
+    user_id   INT         NOT NULL,
+    code_hash VARCHAR(64) NOT NULL,
+    used_at   TIMESTAMPTZ,
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE INDEX recovery_codes_user_id_idx ON recovery_codes (user_id);
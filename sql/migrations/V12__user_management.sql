@@ -0,0 +1,3 @@
+-- Deactivated users keep their data but can no longer log in
+ALTER TABLE users
+    ADD COLUMN active BOOLEAN NOT NULL DEFAULT TRUE;
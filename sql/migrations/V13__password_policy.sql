@@ -0,0 +1,8 @@
+ALTER TABLE users
+    ADD COLUMN must_change_password BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- The seeded admin password is public, it has to be replaced on the first login
+UPDATE users
+SET must_change_password = TRUE
+WHERE name = 'admin'
+  AND password = '$2a$10$SIuDVDLZgCOiQQuzNVSb6.fuDRYQICQuD1.GV2/1OdglPO3740DUS';
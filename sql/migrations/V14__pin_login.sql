@@ -0,0 +1,23 @@
+-- Children may log in with a short PIN, but only from a device registered for their household
+ALTER TABLE users
+    ADD COLUMN pin_hash         VARCHAR(255),
+    ADD COLUMN pin_locked_until TIMESTAMPTZ;
+
+CREATE TABLE devices
+(
+    id           UUID PRIMARY KEY,
+    user_id      INT          NOT NULL,
+    household_id INT          NOT NULL,
+    name         VARCHAR(100) NOT NULL,
+    token_hash   VARCHAR(64)  NOT NULL UNIQUE,
+    created_at   TIMESTAMPTZ  NOT NULL DEFAULT NOW(),
+    revoked_at   TIMESTAMPTZ,
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE,
+    FOREIGN KEY (household_id) REFERENCES households (id) ON DELETE CASCADE
+);
+
+CREATE INDEX devices_user_id_idx ON devices (user_id);
+
+-- PIN sessions get fewer permissions, see middleware.HasPermission
+ALTER TABLE sessions
+    ADD COLUMN auth_method VARCHAR(10) NOT NULL DEFAULT 'password';
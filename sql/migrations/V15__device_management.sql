@@ -0,0 +1,9 @@
+ALTER TABLE devices
+    ADD COLUMN last_seen_at TIMESTAMPTZ,
+    ADD COLUMN last_ip      VARCHAR(45);
+
+-- Sessions opened on a registered device end when the device is revoked
+ALTER TABLE sessions
+    ADD COLUMN device_id UUID REFERENCES devices (id) ON DELETE CASCADE;
+
+CREATE INDEX sessions_device_id_idx ON sessions (device_id);
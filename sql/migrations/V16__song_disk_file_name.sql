@@ -0,0 +1,9 @@
+-- file_name is the name without extension used in URLs, disk_file_name the name of the file in the music directory,
+-- whose extension can be .mp3 in any case. The library scan corrects the rows of files not ending in .mp3.
+ALTER TABLE songs
+    ADD COLUMN disk_file_name VARCHAR(255);
+
+UPDATE songs SET disk_file_name = file_name || '.mp3';
+
+ALTER TABLE songs
+    ALTER COLUMN disk_file_name SET NOT NULL;
@@ -0,0 +1,12 @@
+CREATE TABLE sessions
+(
+    id                 UUID PRIMARY KEY,
+    user_id            INT         NOT NULL,
+    refresh_token_hash VARCHAR(64) NOT NULL UNIQUE,
+    created_at         TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    expires_at         TIMESTAMPTZ NOT NULL,
+    revoked_at         TIMESTAMPTZ,
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE INDEX sessions_user_id_idx ON sessions (user_id);
@@ -0,0 +1,21 @@
+CREATE TABLE songs
+(
+    id           SERIAL PRIMARY KEY,
+    file_name    VARCHAR(255) NOT NULL UNIQUE,
+    title        VARCHAR(255) NOT NULL,
+    artist       VARCHAR(255) NOT NULL DEFAULT '',
+    album        VARCHAR(255) NOT NULL DEFAULT '',
+    track_number INT          NOT NULL DEFAULT 0,
+    duration_ms  INT          NOT NULL DEFAULT 0,
+    file_size    BIGINT       NOT NULL,
+    modified_at  TIMESTAMPTZ  NOT NULL,
+    indexed_at   TIMESTAMPTZ  NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE song_covers
+(
+    song_id   INT PRIMARY KEY,
+    mime_type VARCHAR(100) NOT NULL,
+    data      BYTEA        NOT NULL,
+    FOREIGN KEY (song_id) REFERENCES songs (id) ON DELETE CASCADE
+);
@@ -0,0 +1,20 @@
+-- owner_user_id is NULL for shared household playlists
+CREATE TABLE playlists
+(
+    id            SERIAL PRIMARY KEY,
+    name          VARCHAR(100) NOT NULL,
+    owner_user_id INT,
+    created_at    TIMESTAMPTZ  NOT NULL DEFAULT NOW(),
+    FOREIGN KEY (owner_user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE TABLE playlist_tracks
+(
+    id          SERIAL PRIMARY KEY,
+    playlist_id INT NOT NULL,
+    song_id     INT NOT NULL,
+    position    INT NOT NULL,
+    FOREIGN KEY (playlist_id) REFERENCES playlists (id) ON DELETE CASCADE,
+    FOREIGN KEY (song_id) REFERENCES songs (id) ON DELETE CASCADE,
+    UNIQUE (playlist_id, position) DEFERRABLE INITIALLY DEFERRED
+);
@@ -0,0 +1,18 @@
+-- weekday (0 = Sunday) is only used by the 'weekday' frequency.
+-- materialized_until is the last date the scheduler has created pocket_money rows for.
+CREATE TABLE pocket_money_schedules
+(
+    id                 SERIAL PRIMARY KEY,
+    receiver_user_id   INT         NOT NULL,
+    amount             INT         NOT NULL,
+    frequency          VARCHAR(20) NOT NULL,
+    weekday            INT,
+    start_date         DATE        NOT NULL,
+    end_date           DATE,
+    materialized_until DATE,
+    created_at         TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    FOREIGN KEY (receiver_user_id) REFERENCES users (id) ON DELETE CASCADE,
+    CHECK (frequency IN ('weekly', 'biweekly', 'monthly', 'weekday')),
+    CHECK (frequency <> 'weekday' OR weekday BETWEEN 0 AND 6),
+    CHECK (end_date IS NULL OR end_date >= start_date)
+);
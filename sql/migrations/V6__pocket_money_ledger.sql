@@ -0,0 +1,11 @@
+-- Amounts stay positive, entry_type decides whether an entry is a credit or a debit.
+ALTER TABLE pocket_money
+    ADD COLUMN entry_type  VARCHAR(30)  NOT NULL DEFAULT 'allowance',
+    ADD COLUMN description VARCHAR(255) NOT NULL DEFAULT '',
+    ADD CONSTRAINT pocket_money_entry_type_check
+        CHECK (entry_type IN ('allowance', 'bonus', 'purchase', 'fine', 'savings_transfer'));
+
+-- Only the allowance is limited to one entry per day, purchases or bonuses may share a date with it.
+ALTER TABLE pocket_money DROP CONSTRAINT pocket_money_receiver_user_id_specific_date_key;
+CREATE UNIQUE INDEX pocket_money_allowance_date_key ON pocket_money (receiver_user_id, specific_date)
+    WHERE entry_type = 'allowance';
@@ -0,0 +1,12 @@
+CREATE TABLE savings_goals
+(
+    id            SERIAL PRIMARY KEY,
+    user_id       INT           NOT NULL,
+    name          VARCHAR(100)  NOT NULL,
+    target_amount INT           NOT NULL,
+    deadline      DATE,
+    image_url     VARCHAR(2048) NOT NULL DEFAULT '',
+    created_at    TIMESTAMPTZ   NOT NULL DEFAULT NOW(),
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE,
+    CHECK (target_amount > 0)
+);
@@ -0,0 +1,66 @@
+CREATE TABLE roles
+(
+    name        VARCHAR(50)  PRIMARY KEY,
+    description VARCHAR(255) NOT NULL DEFAULT ''
+);
+
+CREATE TABLE permissions
+(
+    name        VARCHAR(100) PRIMARY KEY,
+    description VARCHAR(255) NOT NULL DEFAULT ''
+);
+
+CREATE TABLE role_permissions
+(
+    role       VARCHAR(50)  NOT NULL,
+    permission VARCHAR(100) NOT NULL,
+    PRIMARY KEY (role, permission),
+    FOREIGN KEY (role) REFERENCES roles (name) ON DELETE CASCADE,
+    FOREIGN KEY (permission) REFERENCES permissions (name) ON DELETE CASCADE
+);
+
+INSERT INTO roles (name, description)
+VALUES ('parent', 'Manages the family, pocket money and shared playlists'),
+       ('child', 'Receives pocket money and manages own goals and playlists'),
+       ('grandparent', 'Follows and contributes to pocket money'),
+       ('guest', 'Can only listen to music');
+
+INSERT INTO permissions (name, description)
+VALUES ('users.read', 'List users'),
+       ('users.manage', 'Create and manage users'),
+       ('account.changePassword', 'Change the own password'),
+       ('pocketMoney.readOwn', 'See the own pocket money'),
+       ('pocketMoney.readAll', 'See the pocket money of every user'),
+       ('pocketMoney.create', 'Create pocket money entries'),
+       ('pocketMoney.acknowledge', 'Confirm or refute the own pocket money entries'),
+       ('pocketMoney.schedules', 'Manage recurring pocket money'),
+       ('goals.manage', 'Manage the own savings goals'),
+       ('music.listen', 'Browse and stream music'),
+       ('music.manage', 'Rescan the music library'),
+       ('playlists.manage', 'Manage the own playlists'),
+       ('playlists.curate', 'Manage shared playlists and the playlists of others');
+
+INSERT INTO role_permissions (role, permission)
+SELECT 'parent', name
+FROM permissions;
+
+INSERT INTO role_permissions (role, permission)
+VALUES ('child', 'account.changePassword'),
+       ('child', 'pocketMoney.readOwn'),
+       ('child', 'pocketMoney.acknowledge'),
+       ('child', 'goals.manage'),
+       ('child', 'music.listen'),
+       ('child', 'playlists.manage'),
+       ('grandparent', 'account.changePassword'),
+       ('grandparent', 'users.read'),
+       ('grandparent', 'pocketMoney.readAll'),
+       ('grandparent', 'pocketMoney.create'),
+       ('grandparent', 'music.listen'),
+       ('grandparent', 'playlists.manage'),
+       ('guest', 'music.listen');
+
+-- The former access levels map onto the new roles
+UPDATE users SET access_level = 'parent' WHERE access_level = 'admin';
+UPDATE users SET access_level = 'child' WHERE access_level = 'user';
+ALTER TABLE users
+    ADD CONSTRAINT users_access_level_fkey FOREIGN KEY (access_level) REFERENCES roles (name);
@@ -0,0 +1,50 @@
+CREATE TABLE households
+(
+    id         SERIAL PRIMARY KEY,
+    name       VARCHAR(100) NOT NULL UNIQUE,
+    created_at TIMESTAMPTZ  NOT NULL DEFAULT NOW()
+);
+
+-- Everything that exists so far belongs to the first household
+INSERT INTO households (name)
+VALUES ('Home');
+
+ALTER TABLE users
+    ADD COLUMN household_id INT REFERENCES households (id);
+UPDATE users
+SET household_id = (SELECT MIN(id) FROM households);
+ALTER TABLE users
+    ALTER COLUMN household_id SET NOT NULL;
+CREATE INDEX users_household_id_idx ON users (household_id);
+
+ALTER TABLE pocket_money
+    ADD COLUMN household_id INT REFERENCES households (id) ON DELETE CASCADE;
+UPDATE pocket_money p
+SET household_id = u.household_id
+FROM users u
+WHERE u.id = p.receiver_user_id;
+ALTER TABLE pocket_money
+    ALTER COLUMN household_id SET NOT NULL;
+CREATE INDEX pocket_money_household_id_idx ON pocket_money (household_id);
+
+ALTER TABLE playlists
+    ADD COLUMN household_id INT REFERENCES households (id) ON DELETE CASCADE;
+UPDATE playlists
+SET household_id = (SELECT MIN(id) FROM households);
+ALTER TABLE playlists
+    ALTER COLUMN household_id SET NOT NULL;
+
+-- Superadmins manage households and have every other permission as well
+INSERT INTO roles (name, description)
+VALUES ('superadmin', 'Manages households on this server');
+INSERT INTO permissions (name, description)
+VALUES ('households.manage', 'Create and manage households');
+INSERT INTO role_permissions (role, permission)
+SELECT 'superadmin', name
+FROM permissions;
+
+-- The seeded admin account becomes the first superadmin
+UPDATE users
+SET access_level = 'superadmin'
+WHERE name = 'admin'
+  AND access_level = 'parent';
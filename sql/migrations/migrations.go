@@ -0,0 +1,7 @@
+// Package migrations embeds the SQL migrations into the binary. They keep the Flyway naming, V<version>__<description>.sql.
+package migrations
+
+import "embed"
+
+//go:embed *.sql
+var FS embed.FS
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"homeApplications/middleware"
+	"homeApplications/models"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// ManageUser handles /user/{id}: PATCH renames, changes the access level or (de)activates a user,
+// DELETE removes the user and everything that belongs to them.
+func ManageUser(w http.ResponseWriter, r *http.Request) {
+	appUser, target, ok := authorizeUserManagement(w, r)
+	if !ok {
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPatch:
+		updateUser(w, r, *appUser, target)
+	case http.MethodDelete:
+		deleteUser(w, r, *appUser, target)
+	default:
+		middleware.WriteError(w, r, middleware.ErrMethodNotAllowed)
+	}
+}
+
+// ResetPassword handles POST /user/{id}/password: an admin sets a new password for a user who forgot theirs.
+// All sessions of the user are revoked and the user has to choose a new password on the next login.
+func ResetPassword(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		middleware.WriteError(w, r, middleware.ErrMethodNotAllowed)
+		return
+	}
+	appUser, target, ok := authorizeUserManagement(w, r)
+	if !ok {
+		return
+	}
+
+	var req models.PasswordResetRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Password == "" {
+		middleware.WriteError(w, r, middleware.ErrInvalidPayload)
+		return
+	}
+	if violations := middleware.ValidatePassword(req.Password, target.Name); len(violations) > 0 {
+		middleware.WriteError(w, r, middleware.PasswordPolicyError(violations))
+		return
+	}
+	hashedPassword, err := middleware.HashPassword(req.Password)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to hash password", "error", err)
+		middleware.WriteError(w, r, middleware.ErrInternal)
+		return
+	}
+	if _, err = dbPool.Exec(r.Context(), "UPDATE users SET password=$1, must_change_password=TRUE WHERE id=$2", hashedPassword, target.ID); err != nil {
+		slog.ErrorContext(r.Context(), "Failed to execute query", "error", err)
+		middleware.WriteError(w, r, middleware.ErrInternal)
+		return
+	}
+	if err = middleware.RevokeUserSessions(r.Context(), target.ID, ""); err != nil {
+		slog.ErrorContext(r.Context(), "Failed to revoke sessions", "error", err)
+	}
+	slog.InfoContext(r.Context(), "Password reset", "target", target, "by", appUser)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// authorizeUserManagement checks that the caller may manage the user in the {id} path segment and loads that user.
+// Only superadmins manage users of other households or other superadmins.
+// It writes the error response itself and returns ok=false in that case.
+func authorizeUserManagement(w http.ResponseWriter, r *http.Request) (*models.AppUser, models.AppUser, bool) {
+	var target models.AppUser
+	appUser, err := middleware.CheckAuthorization(r, models.PermUsersManage)
+	if err != nil {
+		middleware.WriteError(w, r, err)
+		return nil, target, false
+	}
+	userID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		middleware.WriteError(w, r, middleware.ErrInvalidUserID)
+		return nil, target, false
+	}
+
+	err = dbPool.QueryRow(r.Context(), "SELECT id, name, access_level, household_id, active FROM users WHERE id=$1", userID).
+		Scan(&target.ID, &target.Name, &target.Access, &target.HouseholdID, &target.Active)
+	if errors.Is(err, pgx.ErrNoRows) || (err == nil && !middleware.HouseholdScope(r.Context(), *appUser).Includes(target.HouseholdID)) {
+		middleware.WriteError(w, r, middleware.ErrUserNotFound)
+		return nil, target, false
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to execute query", "error", err)
+		middleware.WriteError(w, r, middleware.ErrInternal)
+		return nil, target, false
+	}
+	if target.Access == models.Superadmin && !middleware.HasPermission(r.Context(), *appUser, models.PermHouseholdsManage) {
+		middleware.WriteError(w, r, middleware.ErrForbidden)
+		return nil, target, false
+	}
+	return appUser, target, true
+}
+
+func updateUser(w http.ResponseWriter, r *http.Request, appUser models.AppUser, target models.AppUser) {
+	var req models.UpdateUserRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		middleware.WriteError(w, r, middleware.ErrInvalidPayload)
+		return
+	}
+	if req.Name != nil {
+		if strings.TrimSpace(*req.Name) == "" {
+			middleware.WriteError(w, r, middleware.NewError(http.StatusBadRequest, "name_required", "Name must not be empty"))
+			return
+		}
+		target.Name = strings.TrimSpace(*req.Name)
+	}
+	if req.Access != nil {
+		target.Access = req.Access.Normalize()
+		if target.Access == models.Superadmin && !middleware.HasPermission(r.Context(), appUser, models.PermHouseholdsManage) {
+			middleware.WriteError(w, r, middleware.ErrForbidden)
+			return
+		}
+	}
+	deactivated := req.Active != nil && !*req.Active && target.Active
+	if req.Active != nil {
+		target.Active = *req.Active
+	}
+	// Admins cannot lock themselves out
+	if target.ID == appUser.ID && (!target.Active || target.Access != appUser.Access) {
+		middleware.WriteError(w, r, middleware.NewError(http.StatusBadRequest, "cannot_change_self", "You cannot deactivate yourself or change your own access level"))
+		return
+	}
+
+	_, err := dbPool.Exec(r.Context(), "UPDATE users SET name=$1, access_level=$2, active=$3 WHERE id=$4",
+		target.Name, target.Access, target.Active, target.ID)
+	if err != nil {
+		if pgErr, ok := errors.AsType[*pgconn.PgError](err); ok && pgErr.Code == "23505" { // 23505 is the PostgreSQL error code for unique constraint violation
+			middleware.WriteError(w, r, middleware.NewError(http.StatusConflict, "user_exists", "User already exists"))
+			return
+		} else if ok && pgErr.Code == "23503" { // 23503 is the PostgreSQL error code for foreign key violation
+			middleware.WriteError(w, r, middleware.NewError(http.StatusBadRequest, "unknown_access_level", "Unknown access level"))
+			return
+		}
+		slog.ErrorContext(r.Context(), "Failed to execute query", "error", err)
+		middleware.WriteError(w, r, middleware.ErrInternal)
+		return
+	}
+	if deactivated {
+		if err := middleware.RevokeUserSessions(r.Context(), target.ID, ""); err != nil {
+			slog.ErrorContext(r.Context(), "Failed to revoke sessions", "error", err)
+		}
+	}
+	slog.InfoContext(r.Context(), "User updated", "target", target, "by", appUser)
+	json.NewEncoder(w).Encode(target)
+}
+
+// deleteUser only deletes with ?confirm=true. Without it the response is a conflict whose details list what would be
+// deleted along with the user, so clients can warn before pocket money history is lost.
+func deleteUser(w http.ResponseWriter, r *http.Request, appUser models.AppUser, target models.AppUser) {
+	if target.ID == appUser.ID {
+		middleware.WriteError(w, r, middleware.NewError(http.StatusBadRequest, "cannot_delete_self", "You cannot delete yourself"))
+		return
+	}
+	summary, err := deleteSummary(r.Context(), target.ID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to execute query", "error", err)
+		middleware.WriteError(w, r, middleware.ErrInternal)
+		return
+	}
+	if r.URL.Query().Get("confirm") != "true" {
+		middleware.WriteError(w, r, middleware.NewError(http.StatusConflict, "confirmation_required",
+			"Deleting the user also deletes the listed data, repeat with ?confirm=true").WithDetails(summary))
+		return
+	}
+
+	if _, err := dbPool.Exec(r.Context(), "DELETE FROM users WHERE id=$1", target.ID); err != nil {
+		slog.ErrorContext(r.Context(), "Failed to execute query", "error", err)
+		middleware.WriteError(w, r, middleware.ErrInternal)
+		return
+	}
+	summary.Deleted = true
+	slog.InfoContext(r.Context(), "User deleted", "target", target, "by", appUser, "pocketMoneyEntries", summary.PocketMoneyEntries)
+	json.NewEncoder(w).Encode(summary)
+}
+
+func deleteSummary(ctx context.Context, userID int) (models.DeleteUserSummary, error) {
+	var summary models.DeleteUserSummary
+	err := dbPool.QueryRow(ctx, `SELECT
+			(SELECT COUNT(*) FROM pocket_money WHERE receiver_user_id=$1),
+			(SELECT COUNT(*) FROM pocket_money_schedules WHERE receiver_user_id=$1),
+			(SELECT COUNT(*) FROM savings_goals WHERE user_id=$1),
+			(SELECT COUNT(*) FROM playlists WHERE owner_user_id=$1)`, userID).
+		Scan(&summary.PocketMoneyEntries, &summary.Schedules, &summary.SavingsGoals, &summary.Playlists)
+	return summary, err
+}
+
+// ManagePIN handles /user/{id}/pin: PUT sets the login PIN of a child, DELETE removes it.
+func ManagePIN(w http.ResponseWriter, r *http.Request) {
+	appUser, target, ok := authorizeUserManagement(w, r)
+	if !ok {
+		return
+	}
+	if target.Access != models.Child {
+		middleware.WriteError(w, r, middleware.NewError(http.StatusBadRequest, "pin_child_only", "Only child accounts can log in with a PIN"))
+		return
+	}
+
+	var pin string
+	switch r.Method {
+	case http.MethodPut:
+		var req models.PINRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			middleware.WriteError(w, r, middleware.ErrInvalidPayload)
+			return
+		}
+		if err := middleware.ValidatePIN(req.PIN); err != nil {
+			middleware.WriteError(w, r, err)
+			return
+		}
+		pin = req.PIN
+	case http.MethodDelete:
+	default:
+		middleware.WriteError(w, r, middleware.ErrMethodNotAllowed)
+		return
+	}
+
+	if err := middleware.SetPIN(r.Context(), target.ID, pin); err != nil {
+		slog.ErrorContext(r.Context(), "Failed to execute query", "error", err)
+		middleware.WriteError(w, r, middleware.ErrInternal)
+		return
+	}
+	slog.InfoContext(r.Context(), "PIN changed", "target", target, "by", appUser)
+	w.WriteHeader(http.StatusNoContent)
+}